@@ -0,0 +1,525 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/sql/migrations"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+const usage = `usage:
+  userAuth                          run the API server
+  userAuth migrate up|down|status   manage the database schema
+  userAuth clients list|delete ID   manage OAuth clients
+  userAuth clients add -name NAME -redirect-uri URI [-scope SCOPE] [-audience AUD] [-public]
+                                    register an OAuth client, all but -name and -public may repeat
+  userAuth services list|delete ID  manage service clients
+  userAuth services add -name NAME [-scope SCOPE] [-audience AUD]
+                                    register a service client, -scope and -audience may repeat
+  userAuth users max-sessions EMAIL LIMIT|default
+                                    override how many sessions a user may have, 0 for no limit
+  userAuth users role EMAIL ROLE|none
+                                    set the role named in the user's tokens
+  userAuth keys list|add|promote KID|retire [-force] KID
+                                    manage the HMAC keys tokens are signed with`
+
+func runCommand(args []string) error {
+	switch args[0] {
+	case "migrate":
+		return runMigrate(args[1:])
+	case "clients":
+		return runClients(args[1:])
+	case "services":
+		return runServices(args[1:])
+	case "users":
+		return runUsers(args[1:])
+	case "keys":
+		return runKeys(args[1:])
+	default:
+		return errors.New(usage)
+	}
+}
+
+func runMigrate(args []string) error {
+	if len(args) != 1 {
+		return errors.New(usage)
+	}
+
+	config, err := utils.ReadPostgresConfig()
+	if err != nil {
+		return err
+	}
+
+	db, err := utils.OpenPostgres(config)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := utils.NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Printf("applied %v\n", migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+		return err
+
+	case "down":
+		migration, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if migration == nil {
+			fmt.Println("no migrations to roll back")
+		} else {
+			fmt.Printf("rolled back %v\n", migration.Name)
+		}
+		return nil
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.Applied {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\n", status.Version, status.Name, appliedAt)
+		}
+		return w.Flush()
+
+	default:
+		return errors.New(usage)
+	}
+}
+
+func runClients(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	store, err := utils.NewPostgresStore()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "add":
+		var redirectURIs, scopes, audience stringList
+		flags := flag.NewFlagSet("clients add", flag.ContinueOnError)
+		name := flags.String("name", "", "name shown to users on the consent page")
+		flags.Var(&redirectURIs, "redirect-uri", "allowed redirect URI, may be repeated")
+		flags.Var(&scopes, "scope", "scope the client may request, may be repeated")
+		flags.Var(&audience, "audience", "resource server the client's tokens are also meant for, may be repeated")
+		public := flags.Bool("public", false, "the client cannot keep a secret and relies on PKCE alone")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		if *name == "" || len(redirectURIs) == 0 {
+			return errors.New("-name and at least one -redirect-uri are required")
+		}
+
+		settings, err := utils.ReadSettings()
+		if err != nil {
+			return err
+		}
+		// Users approve clients on a consent page they can only reach logged in with a cookie session
+		if !settings.CookieSessions {
+			return errors.New("OAuth clients need COOKIE_SESSIONS=true, or their users cannot log in to approve them")
+		}
+		for _, redirectURI := range redirectURIs {
+			u, err := url.Parse(redirectURI)
+			if err != nil || !u.IsAbs() || u.Fragment != "" {
+				return fmt.Errorf("redirect URI %q must be an absolute URI without a fragment", redirectURI)
+			}
+		}
+
+		client := models.OAuthClient{
+			ClientID:     uuid.NewString(),
+			Name:         *name,
+			RedirectURIs: redirectURIs,
+			Scopes:       scopes,
+			Audience:     audience,
+		}
+
+		var secret string
+		if !*public {
+			secret, client.SecretHash, err = utils.GenerateOpaqueToken()
+			if err != nil {
+				return err
+			}
+		}
+
+		if _, err := store.CreateOAuthClient(ctx, &client); err != nil {
+			return err
+		}
+
+		fmt.Printf("client_id:     %v\n", client.ClientID)
+		if secret != "" {
+			fmt.Printf("client_secret: %v\n", secret)
+			fmt.Println("the secret is not stored and cannot be shown again")
+		}
+		return nil
+
+	case "list":
+		clients, err := store.ListOAuthClients(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CLIENT ID\tNAME\tTYPE\tSCOPES\tAUDIENCE\tREDIRECT URIS")
+		for _, client := range *clients {
+			clientType := "confidential"
+			if !client.ClientSecretHash.Valid {
+				clientType = "public"
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", client.ClientID, client.ClientName, clientType,
+				strings.Join(client.Scopes, " "), strings.Join(client.Audience, " "), strings.Join(client.RedirectUris, " "))
+		}
+		return w.Flush()
+
+	case "delete":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		if err := store.DeleteOAuthClient(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("deleted %v and every session granted to it\n", args[1])
+		return nil
+
+	default:
+		return errors.New(usage)
+	}
+}
+
+func runServices(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	store, err := utils.NewPostgresStore()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "add":
+		var scopes, audience stringList
+		flags := flag.NewFlagSet("services add", flag.ContinueOnError)
+		name := flags.String("name", "", "name of the service, for the operators' benefit")
+		flags.Var(&scopes, "scope", "scope the service may request, may be repeated")
+		flags.Var(&audience, "audience", "resource server the service's tokens are also meant for, may be repeated")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+
+		if *name == "" {
+			return errors.New("-name is required")
+		}
+
+		client := models.ServiceClient{
+			ClientID: uuid.NewString(),
+			Name:     *name,
+			Scopes:   scopes,
+			Audience: audience,
+		}
+
+		secret, secretHash, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			return err
+		}
+		client.SecretHash = secretHash
+
+		if _, err := store.CreateServiceClient(ctx, &client); err != nil {
+			return err
+		}
+
+		fmt.Printf("client_id:     %v\n", client.ClientID)
+		fmt.Printf("client_secret: %v\n", secret)
+		fmt.Println("the secret is not stored and cannot be shown again")
+		return nil
+
+	case "list":
+		clients, err := store.ListServiceClients(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CLIENT ID\tNAME\tSCOPES\tAUDIENCE\tCREATED AT")
+		for _, client := range *clients {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", client.ClientID, client.ClientName, strings.Join(client.Scopes, " "),
+				strings.Join(client.Audience, " "), client.CreatedAt.Format("2006-01-02 15:04:05"))
+		}
+		return w.Flush()
+
+	case "delete":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		if err := store.DeleteServiceClient(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("deleted %v, the tokens it was issued are no longer accepted\n", args[1])
+		return nil
+
+	default:
+		return errors.New(usage)
+	}
+}
+
+func runUsers(args []string) error {
+	if len(args) != 3 {
+		return errors.New(usage)
+	}
+
+	switch args[0] {
+	case "max-sessions":
+		return runUserMaxSessions(args)
+	case "role":
+		return runUserRole(args)
+	default:
+		return errors.New(usage)
+	}
+}
+
+func runUserMaxSessions(args []string) error {
+	// Unset restores the server-wide MAX_SESSIONS_PER_USER
+	var maxSessions sql.NullInt32
+	if args[2] != "default" {
+		limit, err := strconv.ParseInt(args[2], 10, 32)
+		if err != nil || limit < 0 {
+			return fmt.Errorf("invalid limit %q, expected a number of sessions, 0 or default", args[2])
+		}
+		maxSessions = sql.NullInt32{Int32: int32(limit), Valid: true}
+	}
+
+	store, err := utils.NewPostgresStore()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	user, err := store.GetUserByEmail(ctx, args[1])
+	if err != nil {
+		return err
+	}
+
+	if err := store.SetUserMaxSessions(ctx, user.UserID, maxSessions); err != nil {
+		return err
+	}
+
+	switch {
+	case !maxSessions.Valid:
+		fmt.Printf("%v now uses the server-wide session limit\n", user.Email)
+	case maxSessions.Int32 == 0:
+		fmt.Printf("%v may now have any number of sessions\n", user.Email)
+	default:
+		fmt.Printf("%v may now have %v sessions at once\n", user.Email, maxSessions.Int32)
+	}
+	return nil
+}
+
+func runUserRole(args []string) error {
+	// none leaves the role claim out of the user's tokens
+	var role sql.NullString
+	if args[2] != "none" {
+		if len(args[2]) > 64 {
+			return fmt.Errorf("invalid role %q, at most 64 characters", args[2])
+		}
+		role = sql.NullString{String: args[2], Valid: true}
+	}
+
+	store, err := utils.NewPostgresStore()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	user, err := store.GetUserByEmail(ctx, args[1])
+	if err != nil {
+		return err
+	}
+
+	if err := store.SetUserRole(ctx, user.UserID, role); err != nil {
+		return err
+	}
+
+	if role.Valid {
+		fmt.Printf("%v now has the role %v, from their next token on\n", user.Email, role.String)
+	} else {
+		fmt.Printf("%v no longer has a role, from their next token on\n", user.Email)
+	}
+	return nil
+}
+
+// Manages the HMAC signing keys. A key is added verify-only, so that every instance
+// accepts its tokens before any instance signs with it, and is only retired once it
+// no longer signs tokens.
+func runKeys(args []string) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	store, err := utils.NewPostgresStore()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	switch args[0] {
+	case "add":
+		if len(args) != 1 {
+			return errors.New(usage)
+		}
+
+		kek, err := utils.ReadKeyEncryptionKey()
+		if err != nil {
+			return err
+		}
+		if kek == nil {
+			return errors.New("set JWT_KEY_ENCRYPTION_KEY, the key secrets are encrypted with it before they are stored")
+		}
+
+		kid, secret, err := utils.GenerateHMACKey()
+		if err != nil {
+			return err
+		}
+		sealed, err := kek.Seal(kid, secret)
+		if err != nil {
+			return err
+		}
+		if _, err := store.CreateHMACKey(ctx, kid, sealed); err != nil {
+			return err
+		}
+
+		fmt.Printf("added %v, it is accepted once the servers have reloaded their keys\n", kid)
+		fmt.Printf("promote it after JWT_KEY_RELOAD_INTERVAL with: userAuth keys promote %v\n", kid)
+		return nil
+
+	case "list":
+		if len(args) != 1 {
+			return errors.New(usage)
+		}
+
+		keys, err := store.ListHMACKeys(ctx)
+		if err != nil {
+			return err
+		}
+		active := utils.ActiveHMACKey(*keys)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KID\tSTATUS\tCREATED AT\tPROMOTED AT")
+		for _, key := range *keys {
+			status, promotedAt := "verify", ""
+			if active != nil && key.Kid == active.Kid {
+				status = "signing"
+			}
+			if key.PromotedAt.Valid {
+				promotedAt = key.PromotedAt.Time.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", key.Kid, status, key.CreatedAt.Format("2006-01-02 15:04:05"), promotedAt)
+		}
+		return w.Flush()
+
+	case "promote":
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		if err := store.PromoteHMACKey(ctx, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("promoted %v, it signs new tokens once the servers have reloaded their keys\n", args[1])
+		return nil
+
+	case "retire":
+		flags := flag.NewFlagSet("keys retire", flag.ContinueOnError)
+		force := flags.Bool("force", false, "retire the key even though tokens it signed may not have expired")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New(usage)
+		}
+		kid := flags.Arg(0)
+
+		settings, err := utils.ReadSettings()
+		if err != nil {
+			return err
+		}
+
+		keys, err := store.ListHMACKeys(ctx)
+		if err != nil {
+			return err
+		}
+		if active := utils.ActiveHMACKey(*keys); active != nil && active.Kid == kid {
+			return fmt.Errorf("%v is the signing key, promote another key first", kid)
+		}
+
+		// Servers go on signing with a replaced key until they reload, and its tokens are accepted until they expire
+		now := time.Now().UTC()
+		if lastSigned, ok := utils.HMACKeyLastSigned(*keys, kid, now); ok && !*force {
+			if expiresAt := lastSigned.Add(settings.KeyReloadInterval + settings.AccessTokenTTL); now.Before(expiresAt) {
+				return fmt.Errorf("tokens signed with %v are accepted until %v UTC, retire it then or refuse them now with -force", kid, expiresAt.Format("2006-01-02 15:04:05"))
+			}
+		}
+
+		if err := store.RetireHMACKey(ctx, kid); err != nil {
+			return err
+		}
+		fmt.Printf("retired %v, the tokens it signed are no longer accepted\n", kid)
+		return nil
+
+	default:
+		return errors.New(usage)
+	}
+}
+
+// stringList collects the values of a flag that may be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
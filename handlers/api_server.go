@@ -1,45 +1,143 @@
 package handlers
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/yuanzix/userAuth/models"
 	"github.com/yuanzix/userAuth/utils"
 )
 
 type APIServer struct {
 	listenAddress string
 	store         utils.Storage
+	keys          *utils.KeyRing
+	settings      utils.Settings
+	// Sends mail to users, replaced in tests
+	sendMail func(toMail string, subject string, body string) error
 }
 
+// How long requests in flight get to finish once the server is asked to stop
+const shutdownTimeout = 15 * time.Second
+
 type apiFunc func(http.ResponseWriter, *http.Request) (statusCode int, err error)
-type apiAuthFunc func(http.ResponseWriter, *http.Request, string) (statusCode int, err error)
+type apiAuthFunc func(http.ResponseWriter, *http.Request, models.AuthDetails) (statusCode int, err error)
 
-func NewAPIServer(listenAddress string, store utils.Storage) *APIServer {
+func NewAPIServer(listenAddress string, store utils.Storage, keys *utils.KeyRing, settings utils.Settings) *APIServer {
 	return &APIServer{
 		listenAddress: listenAddress,
 		store:         store,
+		keys:          keys,
+		settings:      settings,
+		sendMail:      utils.SendMail,
 	}
 }
 
+// Serves the API until the process is interrupted or terminated, then lets the requests
+// in flight finish and stops the background work before returning
 func (s *APIServer) Run() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: s.listenAddress, Handler: s.Handler()}
+
+	background, stopBackground := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.reapSessions(background)
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.reloadKeys(background)
+	}()
+
+	served := make(chan error, 1)
+	go func() {
+		served <- server.ListenAndServe()
+	}()
+	log.Printf("JSON API server running on port: %v\n", s.listenAddress)
+
+	select {
+	case err := <-served:
+		log.Printf("JSON API server stopped: %v", err)
+	case <-ctx.Done():
+		log.Println("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("could not shut down cleanly: %v", err)
+		}
+	}
+
+	stopBackground()
+	wg.Wait()
+}
+
+// Handler returns the routed API so it can be served by Run or driven directly, e.g. with httptest.
+func (s *APIServer) Handler() http.Handler {
 	router := http.NewServeMux()
 
 	router.HandleFunc("GET /users", s.makeHTTPHandlerFunc(s.handleGetUsers))
 
 	router.HandleFunc("POST /user", s.makeHTTPHandlerFunc(s.handleCreateUser))
-	router.HandleFunc("GET /user", s.makeProtectedHandlerFunc(s.handleGetUserByEmail))
-	router.HandleFunc("DELETE /user", s.makeProtectedHandlerFunc(s.handleDeleteUser))
+	router.HandleFunc("GET /user", s.makeProtectedHandlerFunc(scopeUserRead, s.handleGetUser))
+	router.HandleFunc("PATCH /user", s.makeProtectedHandlerFunc(scopeUserWrite, s.handleUpdateUser))
+	router.HandleFunc("DELETE /user", s.makeProtectedHandlerFunc("", s.handleDeleteUser))
 
-	router.HandleFunc("GET /user/verify", s.makeProtectedHandlerFunc(s.handleVerifyUser))
+	router.HandleFunc("GET /user/verify", s.makeHTTPHandlerFunc(s.handleVerifyUser))
 	router.HandleFunc("GET /user/isVerified", s.makeHTTPHandlerFunc(s.handleIsVerified))
 	router.HandleFunc("GET /user/resendVerificationMail", s.makeHTTPHandlerFunc(s.handleResendVerificationMail))
 
 	router.HandleFunc("POST /login", s.makeHTTPHandlerFunc(s.handleLogin))
-	router.HandleFunc("GET /logout", s.makeProtectedHandlerFunc(s.handleLogout))
+	router.HandleFunc("GET /logout", s.makeProtectedHandlerFunc("", s.handleLogout))
+	router.HandleFunc("POST /logout", s.makeProtectedHandlerFunc("", s.handleLogout))
 
-	log.Printf("JSON API server running on port: %v\n", s.listenAddress)
-	http.ListenAndServe(s.listenAddress, router)
+	router.HandleFunc("GET /sessions", s.makeProtectedHandlerFunc(scopeSessionsRead, s.handleGetSessions))
+	router.HandleFunc("DELETE /sessions/others", s.makeProtectedHandlerFunc("", s.handleDeleteOtherSessions))
+	router.HandleFunc("DELETE /sessions/{id}", s.makeProtectedHandlerFunc(scopeSessionsWrite, s.handleDeleteSession))
+
+	router.HandleFunc("POST /tokens", s.makeProtectedHandlerFunc("", s.handleCreatePersonalAccessToken))
+	router.HandleFunc("GET /tokens", s.makeProtectedHandlerFunc("", s.handleGetPersonalAccessTokens))
+	router.HandleFunc("DELETE /tokens/{id}", s.makeProtectedHandlerFunc("", s.handleDeletePersonalAccessToken))
+
+	router.HandleFunc("POST /token/refresh", s.makeHTTPHandlerFunc(s.handleRefreshToken))
+	router.HandleFunc("GET /.well-known/jwks.json", s.makeHTTPHandlerFunc(s.handleJWKS))
+
+	// Users approve clients on /oauth/authorize, which they can only reach logged in with a cookie session
+	if s.settings.CookieSessions {
+		router.HandleFunc("GET /oauth/authorize", s.makeProtectedHandlerFunc("", s.handleAuthorize))
+		router.HandleFunc("POST /oauth/authorize", s.makeProtectedHandlerFunc("", s.handleAuthorizeDecision))
+	} else {
+		router.HandleFunc("GET /oauth/authorize", s.makeHTTPHandlerFunc(s.handleAuthorizeUnavailable))
+		router.HandleFunc("POST /oauth/authorize", s.makeHTTPHandlerFunc(s.handleAuthorizeUnavailable))
+	}
+	router.HandleFunc("POST /oauth/token", s.makeOAuthHandlerFunc(s.handleOAuthToken))
+	router.HandleFunc("POST /oauth/introspect", s.makeOAuthHandlerFunc(s.handleIntrospect))
+	router.HandleFunc("POST /oauth/revoke", s.makeOAuthHandlerFunc(s.handleRevoke))
+
+	// The user approves a device on /device, which they can only reach logged in with a cookie session
+	if s.settings.CookieSessions {
+		router.HandleFunc("POST /device/code", s.makeOAuthHandlerFunc(s.handleDeviceCode))
+		router.HandleFunc("GET /device", s.makeProtectedHandlerFunc("", s.handleDevicePage))
+		router.HandleFunc("POST /device", s.makeProtectedHandlerFunc("", s.handleDeviceDecision))
+	}
+
+	router.HandleFunc("GET /.well-known/openid-configuration", s.makeHTTPHandlerFunc(s.handleOpenIDConfiguration))
+	router.HandleFunc("GET /userinfo", s.makeScopedHandlerFunc(scopeOpenID, s.handleUserInfo))
+	router.HandleFunc("POST /userinfo", s.makeScopedHandlerFunc(scopeOpenID, s.handleUserInfo))
+
+	return router
 }
 
 func (s *APIServer) makeHTTPHandlerFunc(f apiFunc) http.HandlerFunc {
@@ -51,17 +149,112 @@ func (s *APIServer) makeHTTPHandlerFunc(f apiFunc) http.HandlerFunc {
 	}
 }
 
-func (s *APIServer) makeProtectedHandlerFunc(af apiAuthFunc) http.HandlerFunc {
+// Protects a first-party endpoint. Sessions may use every endpoint, personal access tokens
+// only those whose scope they were granted; an empty scope admits sessions alone.
+func (s *APIServer) makeProtectedHandlerFunc(scope string, af apiAuthFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		email, err := utils.ValidateToken(r, s.store.CheckAuthExists)
+		var auth *models.AuthDetails
+		var err error
+		if utils.IsPersonalAccessToken(utils.ExtractTokenString(r)) {
+			auth, err = s.validatePersonalAccessToken(r)
+		} else {
+			auth, err = utils.ValidateToken(r, s.keys, s.settings.TokenPolicy(), s.settings.SessionPolicy(), s.store.TouchAuth, s.serviceClientExists)
+		}
 		if err != nil {
 			utils.WriteErrorJSON(w, http.StatusUnauthorized, "Invalid token: "+err.Error())
 			return
 		}
 
-		code, err := af(w, r, email)
+		if auth.PersonalAccessTokenID != 0 && (scope == "" || !hasScope(auth.Scope, scope)) {
+			message := "personal access tokens cannot be used here"
+			if scope != "" {
+				message = "this personal access token was not granted the " + scope + " scope"
+			}
+			utils.WriteErrorJSON(w, http.StatusForbidden, message)
+			return
+		}
+
+		// Service clients act as themselves, and these endpoints all act on a user
+		if auth.Principal == models.PrincipalClient {
+			utils.WriteErrorJSON(w, http.StatusForbidden, "service client tokens cannot be used here")
+			return
+		}
+
+		// Tokens granted to OAuth clients are only accepted by the endpoints meant for them
+		if auth.ClientID != "" {
+			utils.WriteErrorJSON(w, http.StatusForbidden, "this token was granted to an OAuth client and cannot be used here")
+			return
+		}
+
+		// Browsers attach cookies to cross-site requests, so those must prove they come from our own pages
+		if utils.IsCookieAuthenticated(r) && !utils.IsSafeMethod(r.Method) {
+			if err := utils.CheckCSRF(r); err != nil {
+				utils.WriteErrorJSON(w, http.StatusForbidden, err.Error())
+				return
+			}
+		}
+
+		code, err := af(w, r, *auth)
+		if err != nil {
+			utils.WriteErrorJSON(w, code, err.Error())
+		}
+	}
+}
+
+// Protects a resource OAuth clients access on the user's behalf. The token must have been
+// granted scope, and failures are reported the way RFC 6750 section 3 describes.
+func (s *APIServer) makeScopedHandlerFunc(scope string, af apiAuthFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if utils.ExtractTokenString(r) == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="userAuth"`)
+			utils.WriteErrorJSON(w, http.StatusUnauthorized, "Invalid token: token not provided")
+			return
+		}
+
+		auth, err := utils.ValidateToken(r, s.keys, s.settings.TokenPolicy(), s.settings.SessionPolicy(), s.store.TouchAuth, s.serviceClientExists)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="userAuth", error="invalid_token"`)
+			utils.WriteErrorJSON(w, http.StatusUnauthorized, "Invalid token: "+err.Error())
+			return
+		}
+
+		// The resources behind these endpoints belong to a user, which a service client is not
+		if auth.Principal != models.PrincipalUser || auth.ClientID == "" || !hasScope(auth.Scope, scope) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="userAuth", error="insufficient_scope", scope="%v"`, scope))
+			utils.WriteErrorJSON(w, http.StatusForbidden, "the token was not granted the "+scope+" scope")
+			return
+		}
+
+		code, err := af(w, r, *auth)
 		if err != nil {
 			utils.WriteErrorJSON(w, code, err.Error())
 		}
 	}
 }
+
+// Like makeHTTPHandlerFunc, but reports errors the way OAuth clients expect them (RFC 6749 section 5.2)
+func (s *APIServer) makeOAuthHandlerFunc(f apiFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Pragma", "no-cache")
+
+		_, err := f(w, r)
+		if err == nil {
+			return
+		}
+
+		var oauthErr *oauthError
+		if !errors.As(err, &oauthErr) {
+			log.Println("Responding with 5XX error:", err)
+			oauthErr = newOAuthError(http.StatusInternalServerError, "server_error", "")
+		}
+
+		if oauthErr.status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Basic realm="userAuth"`)
+		}
+		utils.WriteJSON(w, oauthErr.status, models.OAuthErrorResponse{
+			Error:            oauthErr.code,
+			ErrorDescription: oauthErr.description,
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+// Drives the routed API over the in-memory store, keeping the mail it would have sent
+type testServer struct {
+	t       *testing.T
+	server  *APIServer
+	handler http.Handler
+	store   *utils.MemoryStore
+	mail    []string
+}
+
+func newTestServer(t *testing.T, configure func(*utils.Settings)) *testServer {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	keys, err := utils.ReadKeyRing()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := utils.DefaultSettings()
+	if configure != nil {
+		configure(&settings)
+	}
+
+	ts := &testServer{t: t, store: utils.NewMemoryStore()}
+	ts.server = NewAPIServer(":0", ts.store, keys, settings)
+	ts.server.sendMail = func(toMail string, subject string, body string) error {
+		ts.mail = append(ts.mail, body)
+		return nil
+	}
+	ts.handler = ts.server.Handler()
+	return ts
+}
+
+// Sends a JSON body, or none if body is nil, with token as the bearer token if it is set
+func (ts *testServer) request(method string, path string, body any, token string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			ts.t.Fatal(err)
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	r := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, r)
+	return w
+}
+
+// Sends a form encoded body, the way OAuth clients and the consent page do
+func (ts *testServer) postForm(path string, form url.Values, token string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, r)
+	return w
+}
+
+func expectStatus(t *testing.T, w *httptest.ResponseRecorder, want int) {
+	t.Helper()
+	if w.Code != want {
+		t.Fatalf("got status %v, want %v: %s", w.Code, want, w.Body.String())
+	}
+}
+
+func decodeBody[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("could not decode %s: %v", w.Body.String(), err)
+	}
+	return v
+}
+
+var verificationLink = regexp.MustCompile(`/user/verify\?token=(\S+)`)
+
+// Signs up a user and follows the verification link mailed to them
+func (ts *testServer) signUpVerified(email string, password string) {
+	ts.t.Helper()
+
+	w := ts.request(http.MethodPost, "/user", map[string]string{
+		"email":         email,
+		"username":      "user",
+		"first_name":    "Test",
+		"last_name":     "User",
+		"password":      password,
+		"date_of_birth": "01-01-2000",
+	}, "")
+	expectStatus(ts.t, w, http.StatusCreated)
+
+	matches := verificationLink.FindStringSubmatch(ts.mail[len(ts.mail)-1])
+	if matches == nil {
+		ts.t.Fatalf("no verification link in %q", ts.mail[len(ts.mail)-1])
+	}
+	expectStatus(ts.t, ts.request(http.MethodGet, "/user/verify?token="+url.QueryEscape(matches[1]), nil, ""), http.StatusOK)
+}
+
+func (ts *testServer) login(email string, password string) models.SessionTokens {
+	ts.t.Helper()
+
+	w := ts.request(http.MethodPost, "/login", map[string]string{"email": email, "password": password}, "")
+	expectStatus(ts.t, w, http.StatusAccepted)
+	return decodeBody[models.LoginResponse](ts.t, w).SessionTokens
+}
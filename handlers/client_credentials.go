@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yuanzix/userAuth/internal/database"
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+// Issues a service client an access token of its own (RFC 6749 section 4.4). There is no
+// user and no session behind it, so no refresh token either; the client asks again when
+// the token runs out.
+func (s *APIServer) exchangeClientCredentials(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
+	client, err := s.authenticateServiceClient(r)
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+
+	requested := strings.Fields(r.PostForm.Get("scope"))
+	if len(requested) == 0 {
+		requested = client.Scopes
+	}
+	for _, scope := range requested {
+		if !slices.Contains(client.Scopes, scope) {
+			return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_scope", "scope "+scope+" is not allowed for this client")
+		}
+	}
+	scope := strings.Join(requested, " ")
+
+	accessToken, err := utils.CreateClientToken(s.keys, s.settings.TokenPolicy(), client.ClientID, scope, client.Audience, s.settings.AccessTokenTTL)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return writeOAuthTokens(w, &models.SessionTokens{
+		AccessToken: accessToken,
+		ExpiresIn:   int64(s.settings.AccessTokenTTL / time.Second),
+	}, scope, "")
+}
+
+// Checks a service client's credentials, sent the same ways as an OAuth client's
+func (s *APIServer) authenticateServiceClient(r *http.Request) (*database.ServiceClient, error) {
+	clientID, secret := clientCredentials(r)
+
+	invalidClient := newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	if clientID == "" || secret == "" {
+		return nil, invalidClient
+	}
+
+	client, err := s.store.GetServiceClient(r.Context(), clientID)
+	if errors.Is(err, utils.ErrServiceClientNotFound) {
+		return nil, invalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(utils.HashOpaqueToken(secret)), []byte(client.ClientSecretHash)) != 1 {
+		return nil, invalidClient
+	}
+
+	return client, nil
+}
+
+// Tokens issued to a service client stop being accepted once the client is deleted
+func (s *APIServer) serviceClientExists(ctx context.Context, clientID string) (bool, error) {
+	_, err := s.store.GetServiceClient(ctx, clientID)
+	if errors.Is(err, utils.ErrServiceClientNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+// The refresh cookie is only sent to the endpoint that exchanges it
+const refreshTokenCookiePath = "/token/refresh"
+
+// Moves the tokens into cookies and replaces them in the response with a fresh CSRF token
+func (s *APIServer) setSessionCookies(w http.ResponseWriter, tokens *models.SessionTokens) error {
+	csrfToken, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, s.sessionCookie(utils.AccessTokenCookie, tokens.AccessToken, "/", int(s.settings.AccessTokenTTL.Seconds()), true))
+	http.SetCookie(w, s.sessionCookie(utils.RefreshTokenCookie, tokens.RefreshToken, refreshTokenCookiePath, int(s.settings.RefreshTokenTTL.Seconds()), true))
+	http.SetCookie(w, s.sessionCookie(utils.CSRFCookie, csrfToken, "/", int(s.settings.RefreshTokenTTL.Seconds()), false))
+
+	tokens.AccessToken = ""
+	tokens.RefreshToken = ""
+	tokens.CSRFToken = csrfToken
+	return nil
+}
+
+func (s *APIServer) clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, s.sessionCookie(utils.AccessTokenCookie, "", "/", -1, true))
+	http.SetCookie(w, s.sessionCookie(utils.RefreshTokenCookie, "", refreshTokenCookiePath, -1, true))
+	http.SetCookie(w, s.sessionCookie(utils.CSRFCookie, "", "/", -1, false))
+}
+
+func (s *APIServer) sessionCookie(name, value, path string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   s.settings.CookieDomain,
+		MaxAge:   maxAge,
+		Secure:   s.settings.CookieSecure,
+		HttpOnly: httpOnly,
+		SameSite: s.settings.CookieSameSite,
+	}
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+// Logs in with use_cookies and returns the cookies the browser would keep
+func (ts *testServer) loginWithCookies(email string, password string) ([]*http.Cookie, models.SessionTokens) {
+	ts.t.Helper()
+
+	w := ts.request(http.MethodPost, "/login", map[string]any{"email": email, "password": password, "use_cookies": true}, "")
+	expectStatus(ts.t, w, http.StatusAccepted)
+	return w.Result().Cookies(), decodeBody[models.LoginResponse](ts.t, w).SessionTokens
+}
+
+// Sends a request with the cookies, and the CSRF header if csrfToken is set
+func (ts *testServer) cookieRequest(method string, path string, cookies []*http.Cookie, csrfToken string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+
+	r := httptest.NewRequest(method, path, nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	if csrfToken != "" {
+		r.Header.Set(utils.CSRFHeader, csrfToken)
+	}
+
+	w := httptest.NewRecorder()
+	ts.handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestCookieSessionCSRF(t *testing.T) {
+	ts := newTestServer(t, func(settings *utils.Settings) {
+		settings.CookieSessions = true
+	})
+	ts.signUpVerified("jane@example.com", "correct horse")
+
+	cookies, tokens := ts.loginWithCookies("jane@example.com", "correct horse")
+	if tokens.AccessToken != "" || tokens.RefreshToken != "" || tokens.CSRFToken == "" {
+		t.Fatalf("a cookie login returned %+v", tokens)
+	}
+	for _, cookie := range cookies {
+		if cookie.HttpOnly != (cookie.Name != utils.CSRFCookie) || !cookie.Secure {
+			t.Errorf("cookie %v has HttpOnly %v and Secure %v", cookie.Name, cookie.HttpOnly, cookie.Secure)
+		}
+	}
+
+	// Reading needs no CSRF token
+	expectStatus(t, ts.cookieRequest(http.MethodGet, "/sessions", cookies, ""), http.StatusOK)
+
+	// Changing state does, and it must be the one in the cookie
+	expectStatus(t, ts.cookieRequest(http.MethodDelete, "/sessions/others", cookies, ""), http.StatusForbidden)
+	expectStatus(t, ts.cookieRequest(http.MethodDelete, "/sessions/others", cookies, "forged"), http.StatusForbidden)
+	expectStatus(t, ts.cookieRequest(http.MethodDelete, "/sessions/others", cookies, tokens.CSRFToken), http.StatusOK)
+
+	// Refreshing from the cookie is checked as well
+	expectStatus(t, ts.cookieRequest(http.MethodPost, "/token/refresh", cookies, ""), http.StatusForbidden)
+
+	// A cookie session can only be ended with POST, which is CSRF checked
+	expectStatus(t, ts.cookieRequest(http.MethodGet, "/logout", cookies, ""), http.StatusMethodNotAllowed)
+	expectStatus(t, ts.cookieRequest(http.MethodPost, "/logout", cookies, ""), http.StatusForbidden)
+	expectStatus(t, ts.cookieRequest(http.MethodPost, "/logout", cookies, tokens.CSRFToken), http.StatusAccepted)
+	expectStatus(t, ts.cookieRequest(http.MethodGet, "/sessions", cookies, ""), http.StatusUnauthorized)
+}
+
+func TestCookieLoginNeedsCookieSessions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.signUpVerified("jane@example.com", "correct horse")
+
+	w := ts.request(http.MethodPost, "/login", map[string]any{"email": "jane@example.com", "password": "correct horse", "use_cookies": true}, "")
+	expectStatus(t, w, http.StatusBadRequest)
+}
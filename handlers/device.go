@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+const (
+	// How long the user has to approve the device once it has started the flow
+	deviceCodeTTL = 10 * time.Minute
+	// How often the device may poll the token endpoint
+	devicePollInterval = 5 * time.Second
+	// The device code grant type of RFC 8628 section 3.4
+	deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+)
+
+var deviceTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Connect a device</title></head>
+<body>
+{{if .Done}}<h1>{{.Done}}</h1>
+<p>You can close this page and return to your device.</p>
+{{else if .UserCode}}<h1>Sign in on {{if .DeviceName}}{{.DeviceName}}{{else}}a new device{{end}}?</h1>
+<p>Only continue if your device shows the code <strong>{{.UserCode}}</strong>. The device will have full access to your account.</p>
+<form method="post" action="/device">
+{{range $name, $value := .Fields}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+{{else}}<h1>Connect a device</h1>
+{{if .Error}}<p>{{.Error}}</p>
+{{end}}<form method="get" action="/device">
+<label>Code shown on your device <input name="user_code" autocomplete="off" autofocus></label>
+<button type="submit">Continue</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// Starts signing in a device that cannot open a browser (RFC 8628 section 3.1). The
+// device shows the user code and polls the token endpoint with the device code until the
+// user has approved it on the verification page.
+func (s *APIServer) handleDeviceCode(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
+	if err := r.ParseForm(); err != nil {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_request", "the body must be form encoded")
+	}
+
+	deviceName := strings.TrimSpace(r.PostForm.Get("device_name"))
+	if len(deviceName) > maxDeviceNameLength {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_request", "device_name is too long")
+	}
+
+	deviceCode, deviceCodeHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// User codes are short enough to collide now and then, in which case another is drawn
+	var userCode string
+	for attempt := 0; attempt < 3; attempt++ {
+		userCode, err = utils.GenerateUserCode()
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		err = s.store.CreateDeviceCode(r.Context(), &models.DeviceCode{
+			DeviceCodeHash: deviceCodeHash,
+			UserCode:       userCode,
+			DeviceName:     deviceName,
+			ExpiresAt:      time.Now().Add(deviceCodeTTL),
+		})
+		if !errors.Is(err, utils.ErrUserCodeTaken) {
+			break
+		}
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	verificationURI := s.settings.Issuer + "/device"
+	return utils.WriteJSON(w, http.StatusOK, models.DeviceAuthorizationResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?" + url.Values{"user_code": {userCode}}.Encode(),
+		ExpiresIn:               int64(deviceCodeTTL / time.Second),
+		Interval:                int64(devicePollInterval / time.Second),
+	})
+}
+
+// The verification page. Asks for the user code, then which device is being signed in,
+// so the user can tell they are approving their own device and not someone else's.
+func (s *APIServer) handleDevicePage(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	userCode := r.URL.Query().Get("user_code")
+	if userCode == "" {
+		return renderDevicePage(w, http.StatusOK, map[string]any{})
+	}
+
+	code, err := s.store.GetPendingDeviceCode(r.Context(), utils.NormalizeUserCode(userCode))
+	if errors.Is(err, utils.ErrDeviceCodeNotFound) {
+		return renderDevicePage(w, http.StatusBadRequest, map[string]any{"Error": "That code is not valid or has expired, check the code on your device."})
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	fields := map[string]string{"user_code": code.UserCode}
+	if cookie, err := r.Cookie(utils.CSRFCookie); err == nil {
+		fields[utils.CSRFFormField] = cookie.Value
+	}
+
+	return renderDevicePage(w, http.StatusOK, map[string]any{
+		"UserCode":   code.UserCode,
+		"DeviceName": code.DeviceName,
+		"Fields":     fields,
+	})
+}
+
+// Records the user's decision on the verification page, which the device learns of when it next polls
+func (s *APIServer) handleDeviceDecision(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	if err := r.ParseForm(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	approved := r.PostForm.Get("decision") == "allow"
+	err = s.store.DecideDeviceCode(r.Context(), utils.NormalizeUserCode(r.PostForm.Get("user_code")), auth.UserID, approved)
+	if errors.Is(err, utils.ErrDeviceCodeNotFound) {
+		return renderDevicePage(w, http.StatusBadRequest, map[string]any{"Error": "That code is not valid or has expired, check the code on your device."})
+	}
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	done := "Device connected"
+	if !approved {
+		done = "Request denied"
+	}
+	return renderDevicePage(w, http.StatusOK, map[string]any{"Done": done})
+}
+
+// Answers the device's polls of the token endpoint (RFC 8628 section 3.5). Once the user
+// has approved the code it is redeemed for a first-party session, as if the user had
+// logged in on the device.
+func (s *APIServer) exchangeDeviceCode(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
+	deviceCode := r.PostForm.Get("device_code")
+	if deviceCode == "" {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_request", "device_code is required")
+	}
+	deviceCodeHash := utils.HashOpaqueToken(deviceCode)
+
+	code, err := s.store.GetDeviceCode(r.Context(), deviceCodeHash)
+	if errors.Is(err, utils.ErrDeviceCodeNotFound) {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_grant", "unknown or already redeemed device_code")
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	now := time.Now()
+	if !now.Before(code.ExpiresAt) {
+		if _, err := s.store.ConsumeDeviceCode(r.Context(), deviceCodeHash); err != nil && !errors.Is(err, utils.ErrDeviceCodeNotFound) {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "expired_token", "the device_code has expired, start again")
+	}
+
+	switch code.Status {
+	case models.DeviceCodePending:
+		tooSoon := code.LastPolledAt.Valid && now.Sub(code.LastPolledAt.Time) < devicePollInterval
+		if err := s.store.MarkDeviceCodePolled(r.Context(), deviceCodeHash); err != nil {
+			return http.StatusInternalServerError, err
+		}
+		if tooSoon {
+			return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "slow_down", "polling too often")
+		}
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "authorization_pending", "the user has not approved the device yet")
+
+	case models.DeviceCodeDenied:
+		if _, err := s.store.ConsumeDeviceCode(r.Context(), deviceCodeHash); err != nil && !errors.Is(err, utils.ErrDeviceCodeNotFound) {
+			return http.StatusInternalServerError, err
+		}
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "access_denied", "the user denied the device")
+	}
+
+	var tokens *models.SessionTokens
+	err = s.store.InTx(r.Context(), func(tx utils.Storage) error {
+		// Only one of several concurrent polls gets to redeem the code
+		approved, err := tx.ConsumeDeviceCode(r.Context(), deviceCodeHash)
+		if err != nil {
+			return err
+		}
+
+		tokens, err = s.createAuthAndToken(r.Context(), tx, approved.UserID.Int32, s.sessionMetadata(r, approved.DeviceName))
+		return err
+	})
+	if errors.Is(err, utils.ErrDeviceCodeNotFound) {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_grant", "unknown or already redeemed device_code")
+	}
+	if errors.Is(err, utils.ErrUserNotFound) {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_grant", "the user no longer exists")
+	}
+	if errors.Is(err, errTooManySessions) {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "access_denied", err.Error())
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return writeOAuthTokens(w, tokens, "", "")
+}
+
+func renderDevicePage(w http.ResponseWriter, statusCode int, data map[string]any) (int, error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// Like the consent page, the approval must not be framed by another site
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(statusCode)
+
+	if err := deviceTemplate.Execute(w, data); err != nil {
+		log.Printf("could not render device page: %v", err)
+	}
+	return statusCode, nil
+}
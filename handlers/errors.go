@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/yuanzix/userAuth/utils"
+)
+
+// Maps errors returned by the store to the status code the API responds with
+func storeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, utils.ErrUserNotFound),
+		errors.Is(err, utils.ErrClientNotFound), errors.Is(err, utils.ErrServiceClientNotFound),
+		errors.Is(err, utils.ErrDeviceCodeNotFound),
+		errors.Is(err, utils.ErrPersonalAccessTokenNotFound), errors.Is(err, utils.ErrHMACKeyNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, utils.ErrEmailTaken), errors.Is(err, utils.ErrClientIDTaken),
+		errors.Is(err, utils.ErrUserCodeTaken), errors.Is(err, utils.ErrHMACKeyTaken):
+		return http.StatusConflict
+	case errors.Is(err, utils.ErrSessionNotFound),
+		errors.Is(err, utils.ErrRefreshTokenNotFound),
+		errors.Is(err, utils.ErrRefreshTokenReused):
+		return http.StatusUnauthorized
+	case errors.Is(err, utils.ErrVerificationTokenInvalid), errors.Is(err, utils.ErrAuthCodeInvalid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
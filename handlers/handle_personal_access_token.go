@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+// Scopes a personal access token can be granted. Endpoints that take none of them, such as
+// deleting the account or managing tokens, can only be used with a session.
+const (
+	scopeUserRead      = "user:read"
+	scopeUserWrite     = "user:write"
+	scopeSessionsRead  = "sessions:read"
+	scopeSessionsWrite = "sessions:write"
+)
+
+var personalAccessTokenScopes = []string{scopeUserRead, scopeUserWrite, scopeSessionsRead, scopeSessionsWrite}
+
+// Column size of the token name in the personal_access_tokens table
+const maxPersonalAccessTokenNameLength = 100
+
+// Creates a personal access token. The token is only ever shown in this response.
+func (s *APIServer) handleCreatePersonalAccessToken(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	type parameters struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+		// RFC 3339, leave out for a token that does not expire
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	params := parameters{}
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	params.Name = strings.TrimSpace(params.Name)
+	if params.Name == "" || len(params.Name) > maxPersonalAccessTokenNameLength {
+		return http.StatusBadRequest, fmt.Errorf("name must be between 1 and %v characters", maxPersonalAccessTokenNameLength)
+	}
+
+	if len(params.Scopes) == 0 {
+		return http.StatusBadRequest, errors.New("at least one scope is required, available scopes are " + strings.Join(personalAccessTokenScopes, ", "))
+	}
+	for _, scope := range params.Scopes {
+		if !slices.Contains(personalAccessTokenScopes, scope) {
+			return http.StatusBadRequest, fmt.Errorf("unknown scope %q, available scopes are %v", scope, strings.Join(personalAccessTokenScopes, ", "))
+		}
+	}
+	slices.Sort(params.Scopes)
+	params.Scopes = slices.Compact(params.Scopes)
+
+	pat := models.PersonalAccessToken{
+		UserID: auth.UserID,
+		Name:   params.Name,
+		Scopes: params.Scopes,
+	}
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			return http.StatusBadRequest, errors.New("expires_at must be in the future")
+		}
+		pat.ExpiresAt = *params.ExpiresAt
+	}
+
+	token, tokenHash, err := utils.GeneratePersonalAccessToken()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	pat.TokenHash = tokenHash
+
+	created, err := s.store.CreatePersonalAccessToken(r.Context(), &pat)
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	response := models.DatabasePersonalAccessTokenToResponse(created)
+	response.Token = token
+
+	return utils.WriteJSON(w, http.StatusCreated, response)
+}
+
+func (s *APIServer) handleGetPersonalAccessTokens(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	tokens, err := s.store.ListPersonalAccessTokens(r.Context(), auth.UserID)
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, models.DatabasePersonalAccessTokensToResponses(tokens))
+}
+
+func (s *APIServer) handleDeletePersonalAccessToken(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+	if err != nil {
+		return http.StatusBadRequest, errors.New("malformed token id")
+	}
+
+	err = s.store.DeletePersonalAccessToken(r.Context(), auth.UserID, int32(id))
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]int64{"deleted": id})
+}
+
+// Looks up the personal access token the request was made with and records it as used
+func (s *APIServer) validatePersonalAccessToken(r *http.Request) (*models.AuthDetails, error) {
+	token, err := s.store.UsePersonalAccessToken(r.Context(), utils.HashOpaqueToken(utils.ExtractTokenString(r)))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.AuthDetails{
+		Principal:             models.PrincipalUser,
+		UserID:                token.UserID,
+		Scope:                 strings.Join(token.Scopes, " "),
+		PersonalAccessTokenID: token.PersonalAccessTokenID,
+	}, nil
+}
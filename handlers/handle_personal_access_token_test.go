@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/yuanzix/userAuth/models"
+)
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.signUpVerified("jane@example.com", "correct horse")
+	session := ts.login("jane@example.com", "correct horse")
+
+	expectStatus(t, ts.request(http.MethodPost, "/tokens", map[string]any{"name": "ci", "scopes": []string{"admin"}}, session.AccessToken), http.StatusBadRequest)
+	expectStatus(t, ts.request(http.MethodPost, "/tokens", map[string]any{"name": "ci"}, session.AccessToken), http.StatusBadRequest)
+
+	w := ts.request(http.MethodPost, "/tokens", map[string]any{"name": "ci", "scopes": []string{"user:read", "sessions:read"}}, session.AccessToken)
+	expectStatus(t, w, http.StatusCreated)
+	pat := decodeBody[models.PersonalAccessTokenResponse](t, w)
+	if pat.Token == "" {
+		t.Fatalf("the token was not returned: %+v", pat)
+	}
+
+	// Granted scopes
+	expectStatus(t, ts.request(http.MethodGet, "/user", nil, pat.Token), http.StatusOK)
+	expectStatus(t, ts.request(http.MethodGet, "/sessions", nil, pat.Token), http.StatusOK)
+
+	// Scopes it was not granted
+	expectStatus(t, ts.request(http.MethodPatch, "/user", map[string]string{"first_name": "Janet"}, pat.Token), http.StatusForbidden)
+	expectStatus(t, ts.request(http.MethodDelete, "/sessions/1", nil, pat.Token), http.StatusForbidden)
+
+	// Endpoints that need a session whatever the scopes
+	expectStatus(t, ts.request(http.MethodPost, "/tokens", map[string]any{"name": "more", "scopes": []string{"user:read"}}, pat.Token), http.StatusForbidden)
+	expectStatus(t, ts.request(http.MethodGet, "/tokens", nil, pat.Token), http.StatusForbidden)
+	expectStatus(t, ts.request(http.MethodDelete, "/sessions/others", nil, pat.Token), http.StatusForbidden)
+	expectStatus(t, ts.request(http.MethodPost, "/logout", nil, pat.Token), http.StatusForbidden)
+	expectStatus(t, ts.request(http.MethodDelete, "/user", nil, pat.Token), http.StatusForbidden)
+
+	// Deleted tokens are refused
+	expectStatus(t, ts.request(http.MethodDelete, fmt.Sprintf("/tokens/%v", pat.ID), nil, session.AccessToken), http.StatusOK)
+	expectStatus(t, ts.request(http.MethodGet, "/user", nil, pat.Token), http.StatusUnauthorized)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yuanzix/userAuth/internal/database"
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+// Column sizes of the session metadata in the auth table
+const (
+	maxUserAgentLength  = 512
+	maxDeviceNameLength = 100
+)
+
+func (s *APIServer) handleGetSessions(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	auths, err := s.store.ListAuth(r.Context(), auth.UserID)
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	// Sessions that have run out are only left until the reaper gets to them
+	policy := s.settings.SessionPolicy()
+	now := time.Now()
+	alive := []database.Auth{}
+	for _, a := range *auths {
+		if !policy.Expired(&a, now) {
+			alive = append(alive, a)
+		}
+	}
+	auths = &alive
+
+	return utils.WriteJSON(w, http.StatusOK, models.DatabaseAuthsToSessionResponses(auths, auth.AuthUUID))
+}
+
+// Revokes one of the user's sessions, which may be the current one
+func (s *APIServer) handleDeleteSession(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 32)
+	if err != nil {
+		return http.StatusBadRequest, errors.New("malformed session id")
+	}
+
+	err = s.store.DeleteUserAuth(r.Context(), auth.UserID, int32(id))
+	if errors.Is(err, utils.ErrSessionNotFound) {
+		return http.StatusNotFound, err
+	}
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]int64{"deleted": id})
+}
+
+// Logs the user out everywhere except the session the request was made with
+func (s *APIServer) handleDeleteOtherSessions(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	deleted, err := s.store.DeleteOtherAuth(r.Context(), auth)
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, map[string]int64{"deleted": deleted})
+}
+
+func (s *APIServer) sessionMetadata(r *http.Request, deviceName string) models.SessionMetadata {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:maxUserAgentLength], "")
+	}
+
+	return models.SessionMetadata{
+		IPAddress:  utils.ClientIP(r, s.settings.TrustProxyHeaders),
+		UserAgent:  userAgent,
+		DeviceName: deviceName,
+	}
+}
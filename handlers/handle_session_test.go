@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/yuanzix/userAuth/models"
+)
+
+func TestSessionEndpoints(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.signUpVerified("jane@example.com", "correct horse")
+	ts.signUpVerified("john@example.com", "battery staple")
+
+	laptop := ts.login("jane@example.com", "correct horse")
+	phone := ts.login("jane@example.com", "correct horse")
+	tablet := ts.login("jane@example.com", "correct horse")
+	john := ts.login("john@example.com", "battery staple")
+
+	w := ts.request(http.MethodGet, "/sessions", nil, laptop.AccessToken)
+	expectStatus(t, w, http.StatusOK)
+	sessions := decodeBody[[]models.SessionResponse](t, w)
+	if len(sessions) != 3 {
+		t.Fatalf("got %v sessions, want 3", len(sessions))
+	}
+
+	var current, other int32
+	for _, session := range sessions {
+		if session.Current {
+			current = session.ID
+		} else {
+			other = session.ID
+		}
+	}
+	if current == 0 {
+		t.Fatal("no session is marked current")
+	}
+
+	// Sessions of other users cannot be revoked
+	w = ts.request(http.MethodGet, "/sessions", nil, john.AccessToken)
+	expectStatus(t, w, http.StatusOK)
+	johnSession := decodeBody[[]models.SessionResponse](t, w)[0].ID
+	expectStatus(t, ts.request(http.MethodDelete, fmt.Sprintf("/sessions/%v", johnSession), nil, laptop.AccessToken), http.StatusNotFound)
+	expectStatus(t, ts.request(http.MethodGet, "/user", nil, john.AccessToken), http.StatusOK)
+
+	expectStatus(t, ts.request(http.MethodDelete, fmt.Sprintf("/sessions/%v", other), nil, laptop.AccessToken), http.StatusOK)
+	w = ts.request(http.MethodGet, "/sessions", nil, laptop.AccessToken)
+	expectStatus(t, w, http.StatusOK)
+	if sessions := decodeBody[[]models.SessionResponse](t, w); len(sessions) != 2 {
+		t.Fatalf("got %v sessions after revoking one, want 2", len(sessions))
+	}
+
+	w = ts.request(http.MethodDelete, "/sessions/others", nil, laptop.AccessToken)
+	expectStatus(t, w, http.StatusOK)
+	if deleted := decodeBody[map[string]int64](t, w)["deleted"]; deleted != 1 {
+		t.Fatalf("deleted %v other sessions, want 1", deleted)
+	}
+	expectStatus(t, ts.request(http.MethodGet, "/user", nil, phone.AccessToken), http.StatusUnauthorized)
+	expectStatus(t, ts.request(http.MethodGet, "/user", nil, tablet.AccessToken), http.StatusUnauthorized)
+	expectStatus(t, ts.request(http.MethodPost, "/token/refresh", map[string]string{"refresh_token": phone.RefreshToken}, ""), http.StatusUnauthorized)
+
+	expectStatus(t, ts.request(http.MethodPost, "/logout", nil, laptop.AccessToken), http.StatusAccepted)
+	expectStatus(t, ts.request(http.MethodGet, "/sessions", nil, laptop.AccessToken), http.StatusUnauthorized)
+	expectStatus(t, ts.request(http.MethodGet, "/user", nil, john.AccessToken), http.StatusOK)
+}
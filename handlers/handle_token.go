@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/yuanzix/userAuth/internal/database"
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+// Exchanges a refresh token for a new token pair. Every refresh token can be used once;
+// presenting one again revokes the session it belongs to, since either the client or
+// whoever stole the token is replaying it and we cannot tell which.
+// Browser clients may leave the body empty and send the refresh cookie instead.
+func (s *APIServer) handleRefreshToken(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
+	type parameters struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	params := parameters{}
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil && !errors.Is(err, io.EOF) {
+		return http.StatusBadRequest, err
+	}
+
+	fromCookie := false
+	if params.RefreshToken == "" && s.settings.CookieSessions {
+		if cookie, err := r.Cookie(utils.RefreshTokenCookie); err == nil {
+			if err := utils.CheckCSRF(r); err != nil {
+				return http.StatusForbidden, err
+			}
+			params.RefreshToken = cookie.Value
+			fromCookie = true
+		}
+	}
+
+	if params.RefreshToken == "" {
+		return http.StatusBadRequest, errors.New("refresh_token not provided")
+	}
+
+	tokens, _, err := s.rotateRefreshToken(r.Context(), params.RefreshToken, "")
+	if (errors.Is(err, errRefreshTokenRevoked) || errors.Is(err, errSessionExpired)) && fromCookie {
+		s.clearSessionCookies(w)
+	}
+	if errors.Is(err, errRefreshTokenExpired) || errors.Is(err, errRefreshTokenRevoked) || errors.Is(err, errSessionExpired) {
+		return http.StatusUnauthorized, err
+	}
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	if fromCookie {
+		if err := s.setSessionCookies(w, tokens); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, tokens)
+}
+
+// Exchanges the refresh token for a new token pair of the same session. clientID is the
+// OAuth client the session must have been granted to, or empty for first-party sessions.
+func (s *APIServer) rotateRefreshToken(ctx context.Context, refreshTokenString string, clientID string) (*models.SessionTokens, *database.Auth, error) {
+	var tokens *models.SessionTokens
+	var auth *database.Auth
+	reused := false
+	expired := false
+
+	err := s.store.InTx(ctx, func(tx utils.Storage) error {
+		refreshToken, err := tx.GetRefreshToken(ctx, utils.HashOpaqueToken(refreshTokenString))
+		if err != nil {
+			return err
+		}
+
+		auth, err = tx.GetAuthByID(ctx, refreshToken.AuthID)
+		if err != nil {
+			return err
+		}
+
+		// A token presented by the wrong party is treated as unknown rather than revoking someone else's session
+		if auth.ClientID.String != clientID {
+			return utils.ErrRefreshTokenNotFound
+		}
+
+		if refreshToken.UsedAt.Valid {
+			reused = true
+			return tx.DeleteAuthByID(ctx, refreshToken.AuthID)
+		}
+
+		if time.Now().After(refreshToken.ExpiresAt) {
+			return errRefreshTokenExpired
+		}
+
+		// Refreshing counts as using the session, unless it has already run out
+		alive, err := tx.TouchAuth(ctx, models.AuthDetails{UserID: auth.UserID, AuthUUID: auth.AuthUuid}, s.settings.SessionPolicy())
+		if err != nil {
+			return err
+		}
+		if !alive {
+			expired = true
+			return tx.DeleteAuthByID(ctx, auth.AuthID)
+		}
+
+		err = tx.UseRefreshToken(ctx, refreshToken.RefreshTokenID)
+		if errors.Is(err, utils.ErrRefreshTokenReused) {
+			reused = true
+			return tx.DeleteAuthByID(ctx, refreshToken.AuthID)
+		}
+		if err != nil {
+			return err
+		}
+
+		tokens, err = s.issueSessionTokens(ctx, tx, auth)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The revocation is committed above, only now is the request rejected
+	if reused {
+		return nil, nil, errRefreshTokenRevoked
+	}
+	if expired {
+		return nil, nil, errSessionExpired
+	}
+
+	return tokens, auth, nil
+}
+
+// Publishes the public signing keys so other services can verify tokens themselves
+func (s *APIServer) handleJWKS(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	return utils.WriteJSON(w, http.StatusOK, s.keys.JWKS())
+}
+
+var (
+	errRefreshTokenExpired = errors.New("refresh token expired")
+	errRefreshTokenRevoked = errors.New("refresh token already used, the session has been revoked")
+	errSessionExpired      = errors.New("the session has expired, log in again")
+	errTooManySessions     = errors.New("the account already has as many sessions as it may, log out of one of them first")
+)
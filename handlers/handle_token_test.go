@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/yuanzix/userAuth/models"
+)
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.signUpVerified("jane@example.com", "correct horse")
+	first := ts.login("jane@example.com", "correct horse")
+
+	w := ts.request(http.MethodPost, "/token/refresh", map[string]string{"refresh_token": first.RefreshToken}, "")
+	expectStatus(t, w, http.StatusOK)
+	second := decodeBody[models.SessionTokens](t, w)
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("the refresh token was not rotated: %+v", second)
+	}
+	expectStatus(t, ts.request(http.MethodGet, "/user", nil, second.AccessToken), http.StatusOK)
+
+	w = ts.request(http.MethodPost, "/token/refresh", map[string]string{"refresh_token": second.RefreshToken}, "")
+	expectStatus(t, w, http.StatusOK)
+	third := decodeBody[models.SessionTokens](t, w)
+
+	expectStatus(t, ts.request(http.MethodPost, "/token/refresh", nil, ""), http.StatusBadRequest)
+	expectStatus(t, ts.request(http.MethodPost, "/token/refresh", map[string]string{"refresh_token": "unknown"}, ""), http.StatusUnauthorized)
+
+	// third has not been used, so the session is still there
+	expectStatus(t, ts.request(http.MethodGet, "/user", nil, third.AccessToken), http.StatusOK)
+}
+
+func TestRefreshTokenReplayDeletesSession(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.signUpVerified("jane@example.com", "correct horse")
+	first := ts.login("jane@example.com", "correct horse")
+	other := ts.login("jane@example.com", "correct horse")
+
+	w := ts.request(http.MethodPost, "/token/refresh", map[string]string{"refresh_token": first.RefreshToken}, "")
+	expectStatus(t, w, http.StatusOK)
+	second := decodeBody[models.SessionTokens](t, w)
+
+	// Replaying the spent token revokes the session, along with the tokens issued since
+	expectStatus(t, ts.request(http.MethodPost, "/token/refresh", map[string]string{"refresh_token": first.RefreshToken}, ""), http.StatusUnauthorized)
+	expectStatus(t, ts.request(http.MethodPost, "/token/refresh", map[string]string{"refresh_token": second.RefreshToken}, ""), http.StatusUnauthorized)
+	expectStatus(t, ts.request(http.MethodGet, "/user", nil, second.AccessToken), http.StatusUnauthorized)
+
+	// The user's other sessions are left alone
+	w = ts.request(http.MethodGet, "/sessions", nil, other.AccessToken)
+	expectStatus(t, w, http.StatusOK)
+	if sessions := decodeBody[[]models.SessionResponse](t, w); len(sessions) != 1 || !sessions[0].Current {
+		t.Fatalf("got sessions %+v, want only the current one", sessions)
+	}
+}
@@ -1,33 +1,116 @@
 package handlers
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/yuanzix/userAuth/internal/database"
 	"github.com/yuanzix/userAuth/models"
 	"github.com/yuanzix/userAuth/utils"
 )
 
+const (
+	defaultUsersPageSize = 20
+	maxUsersPageSize     = 100
+)
+
 func (s *APIServer) handleGetUsers(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
-	users, err := s.store.GetAllUsers()
+	query := r.URL.Query()
+
+	params := models.UserListParams{
+		Limit:  defaultUsersPageSize,
+		SortBy: models.UserSortCreatedAt,
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxUsersPageSize {
+			return http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %v", maxUsersPageSize)
+		}
+		params.Limit = int32(n)
+	}
+
+	switch sortBy := query.Get("sort"); sortBy {
+	case "":
+	case models.UserSortCreatedAt, models.UserSortUsername:
+		params.SortBy = sortBy
+	default:
+		return http.StatusBadRequest, fmt.Errorf("cannot sort by %v", sortBy)
+	}
+
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		params.Descending = true
+	default:
+		return http.StatusBadRequest, errors.New("order must be asc or desc")
+	}
+
+	if verified := query.Get("verified"); verified != "" {
+		v, err := strconv.ParseBool(verified)
+		if err != nil {
+			return http.StatusBadRequest, errors.New("verified must be true or false")
+		}
+		params.Verified = &v
+	}
+
+	if createdAfter := query.Get("created_after"); createdAfter != "" {
+		t, err := utils.StringTimestampToTimeObject(createdAfter)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		params.CreatedAfter = &t
+	}
+
+	if createdBefore := query.Get("created_before"); createdBefore != "" {
+		t, err := utils.StringTimestampToTimeObject(createdBefore)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		params.CreatedBefore = &t
+	}
+
+	if after := query.Get("after"); after != "" {
+		params.After, err = utils.DecodeUserCursor(params, after)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+
+	// Fetch one extra row to find out whether there is a next page
+	pageSize := params.Limit
+	params.Limit++
+
+	users, err := s.store.ListUsers(r.Context(), params)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
-	return utils.WriteJSON(w, http.StatusOK, models.DatabaseUsersToUserResponses(users))
+
+	response := models.UserListResponse{}
+	if int32(len(*users)) > pageSize {
+		page := (*users)[:pageSize]
+		users = &page
+
+		response.NextCursor, err = utils.EncodeUserCursor(params, &page[pageSize-1])
+		if err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	response.Users = models.DatabaseUsersToUserResponses(users)
+
+	return utils.WriteJSON(w, http.StatusOK, response)
 }
 
-func (s *APIServer) handleGetUserByEmail(w http.ResponseWriter, r *http.Request, email string) (statusCode int, err error) {
-	user, err := s.store.GetUserByEmail(email)
+func (s *APIServer) handleGetUser(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	user, err := s.store.GetUserByID(r.Context(), auth.UserID)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return http.StatusNotFound, err
-		}
-		return http.StatusInternalServerError, err
+		return storeErrorStatus(err), err
 	}
 	return utils.WriteJSON(w, http.StatusOK, models.DatabaseUserToUserResponse(user))
 }
@@ -48,6 +131,11 @@ func (s *APIServer) handleCreateUser(w http.ResponseWriter, r *http.Request) (st
 		return http.StatusBadRequest, err
 	}
 
+	params.Email, err = s.normalizeEmail(params.Email)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
 	dob, err := utils.StringDateToTimeObject(params.DateOfBirth)
 	if err != nil {
 		return http.StatusBadRequest, err
@@ -67,15 +155,24 @@ func (s *APIServer) handleCreateUser(w http.ResponseWriter, r *http.Request) (st
 		DateOfBirth:    dob,
 	}
 
-	databaseUser, err := s.store.CreateUser(&user)
-	if err != nil {
-		if strings.Contains(err.Error(), "duplicate key") {
-			return http.StatusConflict, errors.New("the email is already registered")
+	// The user and the verification token are created together, the mail is only sent once both are committed
+	var databaseUser *database.User
+	var tokenString string
+
+	err = s.store.InTx(r.Context(), func(tx utils.Storage) (err error) {
+		databaseUser, err = tx.CreateUser(r.Context(), &user)
+		if err != nil {
+			return err
 		}
-		return http.StatusInternalServerError, err
+
+		tokenString, err = s.createVerificationToken(r.Context(), tx, databaseUser.UserID)
+		return err
+	})
+	if err != nil {
+		return storeErrorStatus(err), err
 	}
 
-	err = s.sendVerificationMail(params.Email)
+	err = s.sendVerificationMail(databaseUser.Email, tokenString)
 
 	if err != nil {
 		response := map[string]interface{}{
@@ -89,18 +186,87 @@ func (s *APIServer) handleCreateUser(w http.ResponseWriter, r *http.Request) (st
 	return utils.WriteJSON(w, http.StatusCreated, models.DatabaseUserToUserResponse(databaseUser))
 }
 
+func (s *APIServer) handleUpdateUser(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	type parameters struct {
+		Username    *string `json:"username"`
+		FirstName   *string `json:"first_name"`
+		LastName    *string `json:"last_name"`
+		DateOfBirth *string `json:"date_of_birth"`
+	}
+
+	params := parameters{}
+
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if params.Username == nil && params.FirstName == nil && params.LastName == nil && params.DateOfBirth == nil {
+		return http.StatusBadRequest, errors.New("no fields to update")
+	}
+
+	// Empty values mean "unchanged" to the store, so reject them instead of silently ignoring them
+	user := models.User{}
+	if params.Username != nil {
+		if *params.Username == "" {
+			return http.StatusBadRequest, errors.New("username cannot be empty")
+		}
+		user.Username = *params.Username
+	}
+	if params.FirstName != nil {
+		if *params.FirstName == "" {
+			return http.StatusBadRequest, errors.New("first_name cannot be empty")
+		}
+		user.FirstName = *params.FirstName
+	}
+	if params.LastName != nil {
+		if *params.LastName == "" {
+			return http.StatusBadRequest, errors.New("last_name cannot be empty")
+		}
+		user.LastName = *params.LastName
+	}
+
+	if params.DateOfBirth != nil {
+		dob, err := utils.StringDateToTimeObject(*params.DateOfBirth)
+		if err != nil {
+			return http.StatusBadRequest, err
+		}
+		user.DateOfBirth = dob
+	}
+
+	databaseUser, err := s.store.UpdateUser(r.Context(), auth.UserID, &user)
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, models.DatabaseUserToUserResponse(databaseUser))
+}
+
 func (s *APIServer) handleResendVerificationMail(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
 	email := r.URL.Query().Get("email")
 	if email == "" {
 		return http.StatusBadRequest, errors.New("email not provided")
 	}
 
-	isVerified, err := s.store.IsUserVerified(email)
-	if err == nil && isVerified {
+	email, err = s.normalizeEmail(email)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	user, err := s.store.GetUserByEmail(r.Context(), email)
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	if user.Verified {
 		return http.StatusConflict, errors.New("email already verified")
 	}
 
-	err = s.sendVerificationMail(email)
+	tokenString, err := s.createVerificationToken(r.Context(), s.store, user.UserID)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	err = s.sendVerificationMail(user.Email, tokenString)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -113,41 +279,61 @@ func (s *APIServer) handleIsVerified(w http.ResponseWriter, r *http.Request) (st
 		return http.StatusBadRequest, errors.New("email not provided")
 	}
 
-	isVerified, err := s.store.IsUserVerified(email)
+	email, err = s.normalizeEmail(email)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return http.StatusNotFound, err
-		}
-		return http.StatusInternalServerError, err
+		return http.StatusBadRequest, err
+	}
+
+	isVerified, err := s.store.IsUserVerified(r.Context(), email)
+	if err != nil {
+		return storeErrorStatus(err), err
 	}
 
 	return utils.WriteJSON(w, http.StatusOK, map[string]bool{"verified": isVerified})
 }
 
-func (s *APIServer) handleVerifyUser(w http.ResponseWriter, r *http.Request, email string) (statusCode int, err error) {
-	isVerified, err := s.store.IsUserVerified(email)
-	if err == nil && isVerified {
-		return http.StatusConflict, errors.New("email already verified")
+// Consumes the token from a verification email. Only tokens issued for email verification
+// are accepted, and each of them only once; the user's sessions are left alone.
+func (s *APIServer) handleVerifyUser(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
+	tokenString := r.URL.Query().Get("token")
+	if tokenString == "" {
+		return http.StatusBadRequest, errors.New("token not provided")
 	}
 
-	err = s.store.VerifyUser(email)
+	var user *database.User
+
+	err = s.store.InTx(r.Context(), func(tx utils.Storage) error {
+		verificationToken, err := tx.ConsumeVerificationToken(r.Context(), models.VerificationPurposeEmail, utils.HashOpaqueToken(tokenString))
+		if err != nil {
+			return err
+		}
+
+		user, err = tx.GetUserByID(r.Context(), verificationToken.UserID)
+		if err != nil || user.Verified {
+			return err
+		}
+
+		return tx.VerifyUser(r.Context(), user.UserID)
+	})
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return storeErrorStatus(err), err
 	}
 
-	// Since only one auth is available at this point we can safely remove using mail as the parameter
-	err = s.store.DeleteAllAuth(email)
-	if err != nil {
-		log.Printf("could not delete auth for %v: %v", email, err)
+	if user.Verified {
+		return http.StatusConflict, errors.New("email already verified")
 	}
 
-	return utils.WriteJSON(w, http.StatusOK, map[string]string{"verified": email})
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"verified": user.Email})
 }
 
 func (s *APIServer) handleLogin(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
 	type parameters struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		// Optional label shown when the user lists their sessions
+		DeviceName string `json:"device_name"`
+		// Keep the session in cookies instead of returning the tokens, if COOKIE_SESSIONS is enabled
+		UseCookies bool `json:"use_cookies"`
 	}
 
 	params := parameters{}
@@ -156,12 +342,26 @@ func (s *APIServer) handleLogin(w http.ResponseWriter, r *http.Request) (statusC
 		return http.StatusBadRequest, err
 	}
 
-	user, err := s.store.GetUserByEmail(params.Email)
+	if params.UseCookies && !s.settings.CookieSessions {
+		return http.StatusBadRequest, errors.New("cookie sessions are not enabled")
+	}
+
+	params.DeviceName = strings.TrimSpace(params.DeviceName)
+	if len(params.DeviceName) > maxDeviceNameLength {
+		return http.StatusBadRequest, fmt.Errorf("device_name cannot be longer than %v bytes", maxDeviceNameLength)
+	}
+
+	params.Email, err = s.normalizeEmail(params.Email)
+	if err != nil {
+		return http.StatusUnauthorized, errors.New("incorrect email or password")
+	}
+
+	user, err := s.store.GetUserByEmail(r.Context(), params.Email)
 	if err != nil {
-		if err == sql.ErrNoRows {
+		if errors.Is(err, utils.ErrUserNotFound) {
 			return http.StatusUnauthorized, errors.New("incorrect email or password")
 		}
-		return http.StatusInternalServerError, err
+		return storeErrorStatus(err), err
 	}
 
 	if !user.Verified {
@@ -173,69 +373,168 @@ func (s *APIServer) handleLogin(w http.ResponseWriter, r *http.Request) (statusC
 		return http.StatusUnauthorized, errors.New("incorrect email or password")
 	}
 
-	tokenString, err := s.createAuthAndToken(params.Email)
+	// The session row and its first refresh token are created together
+	var tokens *models.SessionTokens
+	err = s.store.InTx(r.Context(), func(tx utils.Storage) (err error) {
+		tokens, err = s.createAuthAndToken(r.Context(), tx, user.UserID, s.sessionMetadata(r, params.DeviceName))
+		return err
+	})
+	if errors.Is(err, errTooManySessions) {
+		return http.StatusForbidden, err
+	}
 	if err != nil {
-		return http.StatusInternalServerError, err
+		return storeErrorStatus(err), err
 	}
 
-	return utils.WriteJSON(w, http.StatusAccepted, map[string]string{"login": "successful", "token_string": tokenString})
+	if params.UseCookies {
+		if err := s.setSessionCookies(w, tokens); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	return utils.WriteJSON(w, http.StatusAccepted, models.LoginResponse{Login: "successful", SessionTokens: *tokens})
 }
 
-func (s *APIServer) handleLogout(w http.ResponseWriter, r *http.Request, email string) (statusCode int, err error) {
-	statusCode, err = s.deleteAuth(r)
+func (s *APIServer) handleLogout(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	// GET is kept for token clients, but is not CSRF-checked and so cannot end a cookie session
+	if r.Method == http.MethodGet && utils.IsCookieAuthenticated(r) {
+		return http.StatusMethodNotAllowed, errors.New("use POST /logout to end a cookie session")
+	}
+
+	err = s.store.DeleteAuth(r.Context(), auth)
 	if err != nil {
-		return statusCode, err
+		return storeErrorStatus(err), err
 	}
+
+	s.clearSessionCookies(w)
 	return utils.WriteJSON(w, http.StatusAccepted, map[string]string{"logged_out": "successfully"})
 }
 
-func (s *APIServer) handleDeleteUser(w http.ResponseWriter, r *http.Request, email string) (statusCode int, err error) {
-	statusCode, err = s.deleteAuth(r)
+func (s *APIServer) handleDeleteUser(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	var user *database.User
+
+	// Sessions are removed along with the user by the foreign key
+	err = s.store.InTx(r.Context(), func(tx utils.Storage) (err error) {
+		user, err = tx.GetUserByID(r.Context(), auth.UserID)
+		if err != nil {
+			return err
+		}
+		return tx.DeleteUser(r.Context(), auth.UserID)
+	})
 	if err != nil {
-		return statusCode, err
+		return storeErrorStatus(err), err
 	}
 
-	if err = s.store.DeleteUser(email); err != nil {
-		if err == sql.ErrNoRows {
-			return http.StatusNotFound, err
+	return utils.WriteJSON(w, http.StatusOK, map[string]string{"deleted": user.Email})
+}
+
+// Starts a new session for the user and issues its first token pair
+func (s *APIServer) createAuthAndToken(ctx context.Context, store utils.Storage, userID int32, meta models.SessionMetadata) (*models.SessionTokens, error) {
+	// Grants to OAuth clients are ended by the user or the client, not by logging in elsewhere
+	if meta.ClientID == "" {
+		if err := s.makeRoomForSession(ctx, store, userID); err != nil {
+			return nil, err
 		}
-		return http.StatusInternalServerError, err
 	}
 
-	return utils.WriteJSON(w, http.StatusOK, map[string]string{"deleted": email})
+	auth, err := store.CreateAuth(ctx, userID, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.issueSessionTokens(ctx, store, auth)
 }
 
-func (s *APIServer) deleteAuth(r *http.Request) (statusCode int, err error) {
-	auth, err := utils.ExtractTokenAuth(r)
+// Holds the user to their session limit before another session is started, evicting the
+// least recently used sessions or refusing with errTooManySessions as the policy says.
+// Concurrent logins can overshoot the limit by a session or two.
+func (s *APIServer) makeRoomForSession(ctx context.Context, store utils.Storage, userID int32) error {
+	user, err := store.GetUserByID(ctx, userID)
 	if err != nil {
-		return http.StatusUnauthorized, err
+		return err
 	}
 
-	err = s.store.DeleteAuth(*auth)
-	if err != nil {
-		return http.StatusInternalServerError, err
+	limit := int64(s.settings.MaxSessionsPerUser)
+	if user.MaxSessions.Valid {
+		limit = int64(user.MaxSessions.Int32)
+	}
+	if limit == 0 {
+		return nil
 	}
 
-	return http.StatusOK, nil
+	live, err := store.CountLiveAuth(ctx, userID, s.settings.SessionPolicy())
+	if err != nil || live < limit {
+		return err
+	}
+
+	if s.settings.SessionLimitPolicy == utils.SessionLimitReject {
+		return errTooManySessions
+	}
+
+	_, err = store.DeleteLeastRecentlyUsedAuth(ctx, userID, s.settings.SessionPolicy(), int32(live-limit+1))
+	return err
 }
 
-func (s *APIServer) createAuthAndToken(email string) (tokenString string, err error) {
-	auth, err := s.store.CreateAuth(email)
+// Signs an access token for the session and stores a fresh refresh token alongside it
+func (s *APIServer) issueSessionTokens(ctx context.Context, store utils.Storage, auth *database.Auth) (*models.SessionTokens, error) {
+	// The user's claims are read afresh so a refreshed token reflects any change to them
+	user, err := store.GetUserByID(ctx, auth.UserID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	var clientAudience []string
+	if auth.ClientID.Valid {
+		client, err := store.GetOAuthClient(ctx, auth.ClientID.String)
+		if err != nil {
+			return nil, err
+		}
+		clientAudience = client.Audience
 	}
 
-	tokenString, err = utils.CreateToken(*auth)
-	return
+	accessToken, err := utils.CreateToken(s.keys, s.settings.TokenPolicy(), *auth, *user, clientAudience, s.settings.AccessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshTokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = store.CreateRefreshToken(ctx, auth.AuthID, refreshTokenHash, time.Now().Add(s.settings.RefreshTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.SessionTokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.settings.AccessTokenTTL / time.Second),
+	}, nil
 }
 
-func (s *APIServer) sendVerificationMail(email string) error {
-	tokenString, err := s.createAuthAndToken(email)
+// Stores a single-use email verification token for the user and returns it for the link
+func (s *APIServer) createVerificationToken(ctx context.Context, store utils.Storage, userID int32) (tokenString string, err error) {
+	tokenString, tokenHash, err := utils.GenerateOpaqueToken()
 	if err != nil {
-		return err
+		return "", err
+	}
+
+	_, err = store.CreateVerificationToken(ctx, userID, models.VerificationPurposeEmail, tokenHash, time.Now().Add(s.settings.VerificationTokenTTL))
+	if err != nil {
+		return "", err
 	}
 
+	return tokenString, nil
+}
+
+func (s *APIServer) sendVerificationMail(email string, tokenString string) error {
 	url, _ := utils.ReadBackendURL()
-	err = utils.SendMail(email, "Verify your email", fmt.Sprintf("Click here to verify your email: %v/user/verify?token=%v", url, tokenString))
+	err := s.sendMail(email, "Verify your email", fmt.Sprintf("Click here to verify your email: %v/user/verify?token=%v", url, tokenString))
 	return err
 }
+
+func (s *APIServer) normalizeEmail(email string) (string, error) {
+	return utils.NormalizeEmail(email, s.settings.LowercaseEmailLocalPart)
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestSignUpVerifyAndLogin(t *testing.T) {
+	ts := newTestServer(t, nil)
+
+	w := ts.request(http.MethodPost, "/user", map[string]string{
+		"email":         "Jane@Example.com",
+		"username":      "jane",
+		"first_name":    "Jane",
+		"last_name":     "Doe",
+		"password":      "correct horse",
+		"date_of_birth": "01-01-2000",
+	}, "")
+	expectStatus(t, w, http.StatusCreated)
+
+	// Addresses are compared without regard to case, so signing up again with other casing is refused
+	w = ts.request(http.MethodPost, "/user", map[string]string{
+		"email":         "jane@example.com",
+		"username":      "jane",
+		"first_name":    "Jane",
+		"last_name":     "Doe",
+		"password":      "correct horse",
+		"date_of_birth": "01-01-2000",
+	}, "")
+	expectStatus(t, w, http.StatusConflict)
+
+	w = ts.request(http.MethodPost, "/login", map[string]string{"email": "jane@example.com", "password": "correct horse"}, "")
+	expectStatus(t, w, http.StatusUnauthorized)
+
+	if len(ts.mail) != 1 {
+		t.Fatalf("got %v mails, want 1", len(ts.mail))
+	}
+	link := verificationLink.FindStringSubmatch(ts.mail[0])
+	if link == nil {
+		t.Fatalf("no verification link in %q", ts.mail[0])
+	}
+	verify := "/user/verify?token=" + url.QueryEscape(link[1])
+	expectStatus(t, ts.request(http.MethodGet, verify, nil, ""), http.StatusOK)
+	// Verification links work once
+	expectStatus(t, ts.request(http.MethodGet, verify, nil, ""), http.StatusBadRequest)
+
+	w = ts.request(http.MethodPost, "/login", map[string]string{"email": "jane@example.com", "password": "wrong"}, "")
+	expectStatus(t, w, http.StatusUnauthorized)
+
+	tokens := ts.login("JANE@example.com", "correct horse")
+	if tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatalf("login returned %+v", tokens)
+	}
+
+	w = ts.request(http.MethodGet, "/user", nil, tokens.AccessToken)
+	expectStatus(t, w, http.StatusOK)
+	if user := decodeBody[map[string]any](t, w); user["email"] != "Jane@example.com" {
+		t.Fatalf("got user %v", user)
+	}
+
+	expectStatus(t, ts.request(http.MethodGet, "/user", nil, ""), http.StatusUnauthorized)
+}
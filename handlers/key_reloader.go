@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Keeps the HMAC signing keys in step with the database, so that keys added, promoted
+// or retired with the keys command take effect on every instance without a restart
+func (s *APIServer) reloadKeys(ctx context.Context) {
+	ticker := time.NewTicker(s.settings.KeyReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		signingKid := s.keys.HMACSigningKid()
+		if err := s.keys.ReloadHMACKeys(ctx, s.store); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("could not reload signing keys: %v", err)
+			}
+			continue
+		}
+
+		if kid := s.keys.HMACSigningKid(); kid != signingKid {
+			log.Printf("now signing tokens with key %q", kid)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yuanzix/userAuth/internal/database"
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+// Authorization codes are exchanged by the client straight after the redirect
+const authorizationCodeTTL = time.Minute
+
+// oauthError is an error reported in the format of RFC 6749, either in the token
+// endpoint's response or, for authorization requests, through the redirect URI
+type oauthError struct {
+	status      int
+	code        string
+	description string
+}
+
+func (e *oauthError) Error() string {
+	return e.code + ": " + e.description
+}
+
+func newOAuthError(status int, code string, description string) *oauthError {
+	return &oauthError{status: status, code: code, description: description}
+}
+
+// An authorization request whose client and redirect URI have been checked
+type authorizeRequest struct {
+	client      *database.OauthClient
+	redirectURI string
+	// Whether the request named the redirect URI rather than leaving it to the only registered one
+	redirectURIExplicit bool
+	scope               string
+	state               string
+	codeChallenge       string
+	nonce               string
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorize {{.ClientName}}</title></head>
+<body>
+<h1>{{.ClientName}} wants to access your account</h1>
+{{if .Scopes}}<p>It is asking for:</p>
+<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+<form method="post" action="/oauth/authorize">
+{{range $name, $value := .Fields}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// Answers authorization requests when cookie sessions are off, since the user could not log in to approve them
+func (s *APIServer) handleAuthorizeUnavailable(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
+	return http.StatusNotFound, errors.New("OAuth authorization is not available, it needs COOKIE_SESSIONS=true for users to log in and approve clients")
+}
+
+// Shows the consent page for an authorization request (RFC 6749 section 4.1.1)
+func (s *APIServer) handleAuthorize(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	req, err := s.parseAuthorizeRequest(r, r.URL.Query())
+	if err != nil {
+		return s.authorizeError(w, r, req, err)
+	}
+
+	fields := map[string]string{
+		"response_type":         "code",
+		"client_id":             req.client.ClientID,
+		"scope":                 req.scope,
+		"state":                 req.state,
+		"code_challenge":        req.codeChallenge,
+		"code_challenge_method": "S256",
+		"nonce":                 req.nonce,
+	}
+	// Left out when the request left it out, so the code does not demand it at the token endpoint
+	if req.redirectURIExplicit {
+		fields["redirect_uri"] = req.redirectURI
+	}
+	if cookie, err := r.Cookie(utils.CSRFCookie); err == nil {
+		fields[utils.CSRFFormField] = cookie.Value
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The consent page must not be framed, or another site could trick the user into clicking Allow
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+
+	err = consentTemplate.Execute(w, map[string]any{
+		"ClientName": req.client.ClientName,
+		"Scopes":     strings.Fields(req.scope),
+		"Fields":     fields,
+	})
+	if err != nil {
+		log.Printf("could not render consent page: %v", err)
+	}
+	return http.StatusOK, nil
+}
+
+// Records the user's decision on the consent page and redirects back to the client
+func (s *APIServer) handleAuthorizeDecision(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	if err := r.ParseForm(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	req, err := s.parseAuthorizeRequest(r, r.PostForm)
+	if err != nil {
+		return s.authorizeError(w, r, req, err)
+	}
+
+	if r.PostForm.Get("decision") != "allow" {
+		return s.authorizeError(w, r, req, newOAuthError(http.StatusFound, "access_denied", "the user denied the request"))
+	}
+
+	code, codeHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	err = s.store.CreateAuthorizationCode(r.Context(), &models.AuthorizationCode{
+		CodeHash:            codeHash,
+		ClientID:            req.client.ClientID,
+		UserID:              auth.UserID,
+		RedirectURI:         req.redirectURI,
+		RedirectURIExplicit: req.redirectURIExplicit,
+		Scope:               req.scope,
+		CodeChallenge:       req.codeChallenge,
+		Nonce:               req.nonce,
+		ExpiresAt:           time.Now().Add(authorizationCodeTTL),
+	})
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	http.Redirect(w, r, redirectURL(req.redirectURI, url.Values{"code": {code}}, req.state), http.StatusSeeOther)
+	return http.StatusSeeOther, nil
+}
+
+// Issues tokens for the authorization_code, refresh_token and client_credentials grants
+// (RFC 6749 sections 4.1.3, 6 and 4.4), and for the device code grant (RFC 8628)
+func (s *APIServer) handleOAuthToken(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
+	if err := r.ParseForm(); err != nil {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_request", "the body must be form encoded")
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+
+	// Service clients are registered apart from the OAuth clients acting for users, and
+	// devices sign in to first-party sessions without any client at all
+	switch grantType {
+	case "client_credentials":
+		return s.exchangeClientCredentials(w, r)
+	case deviceCodeGrantType:
+		if !s.settings.CookieSessions {
+			return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "grant_type "+grantType+" is not supported")
+		}
+		return s.exchangeDeviceCode(w, r)
+	}
+
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+
+	switch grantType {
+	case "authorization_code":
+		return s.exchangeAuthorizationCode(w, r, client)
+	case "refresh_token":
+		return s.exchangeOAuthRefreshToken(w, r, client)
+	default:
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "unsupported_grant_type", "grant_type "+grantType+" is not supported")
+	}
+}
+
+func (s *APIServer) exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client *database.OauthClient) (statusCode int, err error) {
+	codeString := r.PostForm.Get("code")
+	verifier := r.PostForm.Get("code_verifier")
+	if codeString == "" || verifier == "" {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_request", "code and code_verifier are required")
+	}
+
+	// The code is spent by any attempt to redeem it, successful or not
+	code, err := s.store.ConsumeAuthorizationCode(r.Context(), utils.HashOpaqueToken(codeString))
+	if errors.Is(err, utils.ErrAuthCodeInvalid) {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_grant", err.Error())
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// The redirect URI must be repeated only if the authorization request named it
+	redirectURI := r.PostForm.Get("redirect_uri")
+	redirectMismatch := (code.RedirectUriExplicit || redirectURI != "") && code.RedirectUri != redirectURI
+	if code.ClientID != client.ClientID || redirectMismatch {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_grant", "the code was issued to another client or redirect_uri")
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(challenge[:])), []byte(code.CodeChallenge)) != 1 {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_grant", "code_verifier does not match the code_challenge")
+	}
+
+	meta := s.sessionMetadata(r, client.ClientName)
+	meta.ClientID = client.ClientID
+	meta.Scope = code.Scope
+
+	var tokens *models.SessionTokens
+	err = s.store.InTx(r.Context(), func(tx utils.Storage) (err error) {
+		tokens, err = s.createAuthAndToken(r.Context(), tx, code.UserID, meta)
+		return err
+	})
+	if errors.Is(err, utils.ErrUserNotFound) {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_grant", "the user no longer exists")
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	idToken, err := s.createIDToken(r.Context(), code.UserID, client.ClientID, code.Scope, code.Nonce)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return writeOAuthTokens(w, tokens, code.Scope, idToken)
+}
+
+func (s *APIServer) exchangeOAuthRefreshToken(w http.ResponseWriter, r *http.Request, client *database.OauthClient) (statusCode int, err error) {
+	refreshToken := r.PostForm.Get("refresh_token")
+	if refreshToken == "" {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_request", "refresh_token is required")
+	}
+
+	tokens, auth, err := s.rotateRefreshToken(r.Context(), refreshToken, client.ClientID)
+	if errors.Is(err, utils.ErrRefreshTokenNotFound) || errors.Is(err, utils.ErrSessionNotFound) ||
+		errors.Is(err, errRefreshTokenExpired) || errors.Is(err, errRefreshTokenRevoked) || errors.Is(err, errSessionExpired) {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_grant", err.Error())
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	idToken, err := s.createIDToken(r.Context(), auth.UserID, client.ClientID, auth.Scope, "")
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return writeOAuthTokens(w, tokens, auth.Scope, idToken)
+}
+
+// Checks the client's credentials. Public clients only identify themselves.
+func (s *APIServer) authenticateClient(r *http.Request) (*database.OauthClient, error) {
+	clientID, secret := clientCredentials(r)
+
+	invalidClient := newOAuthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+	if clientID == "" {
+		return nil, invalidClient
+	}
+
+	client, err := s.store.GetOAuthClient(r.Context(), clientID)
+	if errors.Is(err, utils.ErrClientNotFound) {
+		return nil, invalidClient
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.ClientSecretHash.Valid {
+		if secret == "" || subtle.ConstantTimeCompare([]byte(utils.HashOpaqueToken(secret)), []byte(client.ClientSecretHash.String)) != 1 {
+			return nil, invalidClient
+		}
+	}
+
+	return client, nil
+}
+
+// Reads the credentials a client sent with HTTP Basic authentication or in the form
+func clientCredentials(r *http.Request) (clientID string, secret string) {
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		// RFC 6749 section 2.3.1: both are form encoded before being put in the header
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+		return clientID, secret
+	}
+
+	return r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+}
+
+// Validates an authorization request. Errors found once the client and redirect URI are
+// known to be genuine are sent to the redirect URI, and come with req set.
+func (s *APIServer) parseAuthorizeRequest(r *http.Request, values url.Values) (req *authorizeRequest, err error) {
+	clientID := values.Get("client_id")
+	if clientID == "" {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "client_id not provided")
+	}
+
+	client, err := s.store.GetOAuthClient(r.Context(), clientID)
+	if errors.Is(err, utils.ErrClientNotFound) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_client", "unknown client_id")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	redirectURI := values.Get("redirect_uri")
+	redirectURIExplicit := redirectURI != ""
+	if !redirectURIExplicit && len(client.RedirectUris) == 1 {
+		redirectURI = client.RedirectUris[0]
+	}
+	if !slices.Contains(client.RedirectUris, redirectURI) {
+		return nil, newOAuthError(http.StatusBadRequest, "invalid_request", "redirect_uri is not registered for this client")
+	}
+
+	req = &authorizeRequest{
+		client:              client,
+		redirectURI:         redirectURI,
+		redirectURIExplicit: redirectURIExplicit,
+		state:               values.Get("state"),
+		codeChallenge:       values.Get("code_challenge"),
+		nonce:               values.Get("nonce"),
+	}
+
+	if values.Get("response_type") != "code" {
+		return req, newOAuthError(http.StatusFound, "unsupported_response_type", "only the code response type is supported")
+	}
+
+	// PKCE is required of every client, and only with S256
+	if values.Get("code_challenge_method") != "S256" || len(req.codeChallenge) != 43 {
+		return req, newOAuthError(http.StatusFound, "invalid_request", "a S256 code_challenge is required")
+	}
+
+	requested := strings.Fields(values.Get("scope"))
+	if len(requested) == 0 {
+		requested = client.Scopes
+	}
+	for _, scope := range requested {
+		if !slices.Contains(client.Scopes, scope) {
+			return req, newOAuthError(http.StatusFound, "invalid_scope", "scope "+scope+" is not allowed for this client")
+		}
+		// Without an asymmetric key there is no ID token the client could check
+		if scope == scopeOpenID && !s.keys.CanSignIDTokens() {
+			return req, newOAuthError(http.StatusFound, "invalid_scope", "OpenID Connect is not configured on this server")
+		}
+	}
+	req.scope = strings.Join(requested, " ")
+
+	return req, nil
+}
+
+// Sends an authorization error to the client through its redirect URI, or straight to
+// the user if the redirect URI could not be trusted
+func (s *APIServer) authorizeError(w http.ResponseWriter, r *http.Request, req *authorizeRequest, err error) (statusCode int, _ error) {
+	var oauthErr *oauthError
+	if !errors.As(err, &oauthErr) {
+		return storeErrorStatus(err), err
+	}
+	if req == nil {
+		return oauthErr.status, errors.New(oauthErr.description)
+	}
+
+	query := url.Values{"error": {oauthErr.code}, "error_description": {oauthErr.description}}
+	http.Redirect(w, r, redirectURL(req.redirectURI, query, req.state), http.StatusFound)
+	return http.StatusFound, nil
+}
+
+// Adds the parameters, and state if any, to the query of a registered redirect URI
+func redirectURL(redirectURI string, params url.Values, state string) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func writeOAuthTokens(w http.ResponseWriter, tokens *models.SessionTokens, scope string, idToken string) (int, error) {
+	return utils.WriteJSON(w, http.StatusOK, models.OAuthTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+		Scope:        scope,
+		IDToken:      idToken,
+	})
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/yuanzix/userAuth/internal/database"
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+// Returned by the token lookups for tokens that are malformed, expired, spent or whose
+// session has ended. Introspection and revocation treat them all the same way.
+var errTokenInactive = errors.New("token is not active")
+
+// The session an access or refresh token belongs to
+type tokenSession struct {
+	// Nil for the tokens of service clients, which have no session
+	auth *database.Auth
+	// access_token or refresh_token, as in the token_type_hint parameter
+	tokenType string
+	expiresAt time.Time
+	subject   string
+	clientID  string
+	scope     string
+}
+
+// Tells a resource server whether a token is active and what it grants (RFC 7662).
+// Only confidential clients and service clients may ask, as the answer would help guess tokens.
+func (s *APIServer) handleIntrospect(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
+	if err := r.ParseForm(); err != nil {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_request", "the body must be form encoded")
+	}
+
+	client, err := s.authenticateClient(r)
+	if err == nil && !client.ClientSecretHash.Valid {
+		err = newOAuthError(http.StatusUnauthorized, "invalid_client", "public clients cannot introspect tokens")
+	}
+	var oauthErr *oauthError
+	if errors.As(err, &oauthErr) && oauthErr.code == "invalid_client" {
+		// Resource servers are usually registered as service clients instead
+		if _, serviceErr := s.authenticateServiceClient(r); serviceErr == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	session, err := s.lookupToken(r.Context(), token, r.PostForm.Get("token_type_hint"))
+	if errors.Is(err, errTokenInactive) {
+		return utils.WriteJSON(w, http.StatusOK, models.IntrospectionResponse{Active: false})
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return utils.WriteJSON(w, http.StatusOK, models.IntrospectionResponse{
+		Active:    true,
+		Subject:   session.subject,
+		ClientID:  session.clientID,
+		Scope:     session.scope,
+		ExpiresAt: session.expiresAt.Unix(),
+		TokenType: session.tokenType,
+	})
+}
+
+// Lets a client end a session it was granted (RFC 7009). Access and refresh tokens
+// belong to the same session, so revoking either one revokes both.
+func (s *APIServer) handleRevoke(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
+	if err := r.ParseForm(); err != nil {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_request", "the body must be form encoded")
+	}
+
+	client, err := s.authenticateClient(r)
+	if err != nil {
+		return http.StatusUnauthorized, err
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "invalid_request", "token is required")
+	}
+
+	session, err := s.lookupToken(r.Context(), token, r.PostForm.Get("token_type_hint"))
+	// There is nothing left to revoke, which the client is not told about (RFC 7009 section 2.2)
+	if errors.Is(err, errTokenInactive) {
+		w.WriteHeader(http.StatusOK)
+		return http.StatusOK, nil
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// Service client tokens are stateless and stay valid until they expire
+	if session.auth == nil {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "unsupported_token_type", "tokens issued to service clients cannot be revoked")
+	}
+
+	if session.auth.ClientID.String != client.ClientID {
+		return http.StatusBadRequest, newOAuthError(http.StatusBadRequest, "unauthorized_client", "the token was not issued to this client")
+	}
+
+	err = s.store.DeleteAuthByID(r.Context(), session.auth.AuthID)
+	if err != nil && !errors.Is(err, utils.ErrSessionNotFound) {
+		return http.StatusInternalServerError, err
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return http.StatusOK, nil
+}
+
+// Finds the session of an access or refresh token, trying the kind the hint names first
+func (s *APIServer) lookupToken(ctx context.Context, token string, hint string) (*tokenSession, error) {
+	lookups := []func(context.Context, string) (*tokenSession, error){s.lookupAccessToken, s.lookupRefreshToken}
+	if hint == "refresh_token" {
+		lookups[0], lookups[1] = lookups[1], lookups[0]
+	}
+
+	for _, lookup := range lookups {
+		session, err := lookup(ctx, token)
+		if !errors.Is(err, errTokenInactive) {
+			return session, err
+		}
+	}
+
+	return nil, errTokenInactive
+}
+
+func (s *APIServer) lookupAccessToken(ctx context.Context, token string) (*tokenSession, error) {
+	details, err := utils.ParseTokenAuth(token, s.keys, s.settings.TokenPolicy())
+	if err != nil {
+		return nil, errTokenInactive
+	}
+
+	if details.Principal == models.PrincipalClient {
+		exists, err := s.serviceClientExists(ctx, details.ClientID)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, errTokenInactive
+		}
+
+		return &tokenSession{
+			tokenType: "access_token",
+			expiresAt: details.ExpiresAt,
+			subject:   details.ClientID,
+			clientID:  details.ClientID,
+			scope:     details.Scope,
+		}, nil
+	}
+
+	auth, err := s.store.GetAuthByUUID(ctx, *details)
+	if errors.Is(err, utils.ErrSessionNotFound) {
+		return nil, errTokenInactive
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.settings.SessionPolicy().Expired(auth, time.Now()) {
+		return nil, errTokenInactive
+	}
+
+	return newTokenSession(auth, "access_token", details.ExpiresAt), nil
+}
+
+func (s *APIServer) lookupRefreshToken(ctx context.Context, token string) (*tokenSession, error) {
+	refreshToken, err := s.store.GetRefreshToken(ctx, utils.HashOpaqueToken(token))
+	if errors.Is(err, utils.ErrRefreshTokenNotFound) {
+		return nil, errTokenInactive
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if refreshToken.UsedAt.Valid || time.Now().After(refreshToken.ExpiresAt) {
+		return nil, errTokenInactive
+	}
+
+	auth, err := s.store.GetAuthByID(ctx, refreshToken.AuthID)
+	if errors.Is(err, utils.ErrSessionNotFound) {
+		return nil, errTokenInactive
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.settings.SessionPolicy().Expired(auth, time.Now()) {
+		return nil, errTokenInactive
+	}
+
+	return newTokenSession(auth, "refresh_token", refreshToken.ExpiresAt), nil
+}
+
+func newTokenSession(auth *database.Auth, tokenType string, expiresAt time.Time) *tokenSession {
+	return &tokenSession{
+		auth:      auth,
+		tokenType: tokenType,
+		expiresAt: expiresAt,
+		subject:   utils.UserSubject(auth.UserID),
+		clientID:  auth.ClientID.String,
+		scope:     auth.Scope,
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+const testRedirectURI = "https://app.example.com/callback"
+
+func newOAuthTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	ts := newTestServer(t, func(settings *utils.Settings) {
+		settings.CookieSessions = true
+	})
+	_, err := ts.store.CreateOAuthClient(context.Background(), &models.OAuthClient{
+		ClientID:     "app",
+		Name:         "App",
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       []string{"profile"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ts
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// Approves an authorization request on the consent page and returns the code the client is redirected with
+func (ts *testServer) authorize(accessToken string, challenge string) string {
+	ts.t.Helper()
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"app"},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"profile"},
+		"state":                 {"xyz"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	w := ts.request(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil, accessToken)
+	expectStatus(ts.t, w, http.StatusOK)
+	if !strings.Contains(w.Body.String(), "App wants to access your account") {
+		ts.t.Fatalf("got consent page %s", w.Body.String())
+	}
+
+	query.Set("decision", "allow")
+	w = ts.postForm("/oauth/authorize", query, accessToken)
+	expectStatus(ts.t, w, http.StatusSeeOther)
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		ts.t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURI+"?") || location.Query().Get("state") != "xyz" {
+		ts.t.Fatalf("redirected to %v", location)
+	}
+	return location.Query().Get("code")
+}
+
+func (ts *testServer) exchangeCode(code string, verifier string) *models.OAuthTokenResponse {
+	ts.t.Helper()
+
+	w := ts.postForm("/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {"app"},
+		"code":          {code},
+		"code_verifier": {verifier},
+		"redirect_uri":  {testRedirectURI},
+	}, "")
+	if w.Code != http.StatusOK {
+		if oauthErr := decodeBody[models.OAuthErrorResponse](ts.t, w); oauthErr.Error != "invalid_grant" {
+			ts.t.Fatalf("got error %+v, want invalid_grant", oauthErr)
+		}
+		return nil
+	}
+
+	tokens := decodeBody[models.OAuthTokenResponse](ts.t, w)
+	return &tokens
+}
+
+func TestAuthorizationCodeWithPKCE(t *testing.T) {
+	ts := newOAuthTestServer(t)
+	ts.signUpVerified("jane@example.com", "correct horse")
+	session := ts.login("jane@example.com", "correct horse")
+
+	verifier := strings.Repeat("v", 43)
+
+	// A verifier that does not match the challenge is refused, and spends the code
+	code := ts.authorize(session.AccessToken, codeChallenge(verifier))
+	if tokens := ts.exchangeCode(code, strings.Repeat("w", 43)); tokens != nil {
+		t.Fatal("the code was exchanged with the wrong code_verifier")
+	}
+	if tokens := ts.exchangeCode(code, verifier); tokens != nil {
+		t.Fatal("the code was exchanged twice")
+	}
+
+	code = ts.authorize(session.AccessToken, codeChallenge(verifier))
+	tokens := ts.exchangeCode(code, verifier)
+	if tokens == nil || tokens.AccessToken == "" || tokens.RefreshToken == "" || tokens.Scope != "profile" {
+		t.Fatalf("got tokens %+v", tokens)
+	}
+	if tokens := ts.exchangeCode(code, verifier); tokens != nil {
+		t.Fatal("the code was exchanged twice")
+	}
+
+	// The client's session is listed for the user, and its token is refused by the first-party endpoints
+	w := ts.request(http.MethodGet, "/sessions", nil, session.AccessToken)
+	expectStatus(t, w, http.StatusOK)
+	var granted bool
+	for _, s := range decodeBody[[]models.SessionResponse](t, w) {
+		granted = granted || s.ClientID == "app"
+	}
+	if !granted {
+		t.Fatal("the session granted to the client is not listed")
+	}
+	expectStatus(t, ts.request(http.MethodGet, "/user", nil, tokens.AccessToken), http.StatusForbidden)
+}
+
+func TestAuthorizationRequiresPKCE(t *testing.T) {
+	ts := newOAuthTestServer(t)
+	ts.signUpVerified("jane@example.com", "correct horse")
+	session := ts.login("jane@example.com", "correct horse")
+
+	query := url.Values{
+		"response_type": {"code"},
+		"client_id":     {"app"},
+		"redirect_uri":  {testRedirectURI},
+		"scope":         {"profile"},
+	}
+	w := ts.request(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil, session.AccessToken)
+	expectStatus(t, w, http.StatusFound)
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location.Query().Get("error") != "invalid_request" {
+		t.Fatalf("redirected to %v, want an invalid_request error", location)
+	}
+}
+
+func TestAuthorizationWithoutCookieSessions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	ts.signUpVerified("jane@example.com", "correct horse")
+	session := ts.login("jane@example.com", "correct horse")
+
+	expectStatus(t, ts.request(http.MethodGet, "/oauth/authorize?client_id=app", nil, session.AccessToken), http.StatusNotFound)
+	expectStatus(t, ts.postForm("/oauth/authorize", url.Values{"client_id": {"app"}}, session.AccessToken), http.StatusNotFound)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/yuanzix/userAuth/internal/database"
+	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/utils"
+)
+
+// Scopes with a meaning defined by OpenID Connect. Clients may be registered with others too.
+const (
+	scopeOpenID  = "openid"
+	scopeProfile = "profile"
+	scopeEmail   = "email"
+)
+
+// Describes the provider to OpenID Connect client libraries
+func (s *APIServer) handleOpenIDConfiguration(w http.ResponseWriter, r *http.Request) (statusCode int, err error) {
+	if s.settings.Issuer == "" || !s.keys.CanSignIDTokens() {
+		return http.StatusNotFound, errors.New("OpenID Connect is not configured, set JWT_SIGNING_KEY_FILE and OIDC_ISSUER or BACKEND_URL")
+	}
+
+	grantTypes := []string{"authorization_code", "refresh_token", "client_credentials"}
+	var deviceAuthorizationEndpoint string
+	if s.settings.CookieSessions {
+		grantTypes = append(grantTypes, deviceCodeGrantType)
+		deviceAuthorizationEndpoint = s.settings.Issuer + "/device/code"
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	return utils.WriteJSON(w, http.StatusOK, models.OpenIDConfiguration{
+		Issuer:                            s.settings.Issuer,
+		AuthorizationEndpoint:             s.settings.Issuer + "/oauth/authorize",
+		TokenEndpoint:                     s.settings.Issuer + "/oauth/token",
+		UserInfoEndpoint:                  s.settings.Issuer + "/userinfo",
+		JWKSURI:                           s.settings.Issuer + "/.well-known/jwks.json",
+		IntrospectionEndpoint:             s.settings.Issuer + "/oauth/introspect",
+		RevocationEndpoint:                s.settings.Issuer + "/oauth/revoke",
+		DeviceAuthorizationEndpoint:       deviceAuthorizationEndpoint,
+		ScopesSupported:                   []string{scopeOpenID, scopeProfile, scopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               grantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{s.keys.SigningAlg()},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported: []string{
+			"sub", "name", "given_name", "family_name", "preferred_username",
+			"birthdate", "updated_at", "email", "email_verified",
+		},
+	})
+}
+
+// Returns the claims about the user that the client's token was granted
+func (s *APIServer) handleUserInfo(w http.ResponseWriter, r *http.Request, auth models.AuthDetails) (statusCode int, err error) {
+	user, err := s.store.GetUserByID(r.Context(), auth.UserID)
+	if err != nil {
+		return storeErrorStatus(err), err
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	return utils.WriteJSON(w, http.StatusOK, userInfo(user, auth.Scope))
+}
+
+// Signs an ID token for the user if the client was granted the openid scope, and returns
+// an empty string otherwise
+func (s *APIServer) createIDToken(ctx context.Context, userID int32, clientID string, scope string, nonce string) (string, error) {
+	if !hasScope(scope, scopeOpenID) {
+		return "", nil
+	}
+
+	user, err := s.store.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	return utils.CreateIDToken(s.keys, s.settings.Issuer, clientID, nonce, userInfo(user, scope), s.settings.AccessTokenTTL)
+}
+
+// Maps the user to the standard claims the scope allows
+func userInfo(user *database.User, scope string) models.UserInfo {
+	info := models.UserInfo{Subject: utils.UserSubject(user.UserID)}
+
+	if hasScope(scope, scopeProfile) {
+		info.Name = strings.TrimSpace(user.FirstName + " " + user.LastName)
+		info.GivenName = user.FirstName
+		info.FamilyName = user.LastName
+		info.PreferredUsername = user.Username
+		if !user.DateOfBirth.IsZero() {
+			info.Birthdate = user.DateOfBirth.Format(time.DateOnly)
+		}
+		info.UpdatedAt = user.UpdatedAt.Unix()
+	}
+
+	if hasScope(scope, scopeEmail) {
+		verified := user.Verified
+		info.Email = user.Email
+		info.EmailVerified = &verified
+	}
+
+	return info
+}
+
+// Reports whether the space-separated scope list includes scope
+func hasScope(scopes string, scope string) bool {
+	return slices.Contains(strings.Fields(scopes), scope)
+}
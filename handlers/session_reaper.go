@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Rows deleted per statement, so a large backlog does not keep a table locked for long
+const reapBatchSize = 500
+
+// Deletes sessions that have run out, and the tokens that can no longer be used, every
+// SessionReapInterval until ctx is cancelled
+func (s *APIServer) reapSessions(ctx context.Context) {
+	ticker := time.NewTicker(s.settings.SessionReapInterval)
+	defer ticker.Stop()
+
+	for {
+		s.reapExpired(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *APIServer) reapExpired(ctx context.Context) {
+	if policy := s.settings.SessionPolicy(); policy.Enabled() {
+		reapInBatches(ctx, "expired sessions", func(ctx context.Context) (int64, error) {
+			return s.store.DeleteExpiredAuth(ctx, policy, reapBatchSize)
+		})
+	}
+
+	reapInBatches(ctx, "expired refresh tokens", func(ctx context.Context) (int64, error) {
+		return s.store.DeleteExpiredRefreshTokens(ctx, reapBatchSize)
+	})
+
+	reapInBatches(ctx, "used or expired verification tokens", func(ctx context.Context) (int64, error) {
+		return s.store.DeleteStaleVerificationTokens(ctx, reapBatchSize)
+	})
+
+	reapInBatches(ctx, "expired authorization codes", func(ctx context.Context) (int64, error) {
+		return s.store.DeleteExpiredAuthorizationCodes(ctx, reapBatchSize)
+	})
+
+	reapInBatches(ctx, "expired device codes", func(ctx context.Context) (int64, error) {
+		return s.store.DeleteExpiredDeviceCodes(ctx, reapBatchSize)
+	})
+}
+
+// Calls deleteBatch until it deletes less than a full batch, and logs how many rows went
+func reapInBatches(ctx context.Context, what string, deleteBatch func(context.Context) (int64, error)) {
+	var total int64
+	for ctx.Err() == nil {
+		deleted, err := deleteBatch(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("could not delete %v: %v", what, err)
+			}
+			break
+		}
+
+		total += deleted
+		if deleted < reapBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("deleted %v %v", total, what)
+	}
+}
@@ -7,82 +7,391 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const checkAuthExists = `-- name: CheckAuthExists :one
 SELECT EXISTS(
-    SELECT auth_id, user_email, auth_uuid FROM auth
+    SELECT auth_id, auth_uuid, user_id, created_at, last_used_at, ip_address, user_agent, device_name, client_id, scope FROM auth
     WHERE
-        user_email = $1
+        user_id = $1
         AND auth_uuid = $2
 )
 `
 
 type CheckAuthExistsParams struct {
-	UserEmail string
-	AuthUuid  uuid.UUID
+	UserID   int32
+	AuthUuid uuid.UUID
 }
 
 func (q *Queries) CheckAuthExists(ctx context.Context, arg CheckAuthExistsParams) (bool, error) {
-	row := q.db.QueryRowContext(ctx, checkAuthExists, arg.UserEmail, arg.AuthUuid)
+	row := q.db.QueryRowContext(ctx, checkAuthExists, arg.UserID, arg.AuthUuid)
 	var exists bool
 	err := row.Scan(&exists)
 	return exists, err
 }
 
+const countLiveAuth = `-- name: CountLiveAuth :one
+SELECT COUNT(*) FROM auth
+WHERE
+    user_id = $1
+    AND client_id IS NULL
+    AND last_used_at >= $2
+    AND created_at >= $3
+`
+
+type CountLiveAuthParams struct {
+	UserID         int32
+	IdleCutoff     time.Time
+	LifetimeCutoff time.Time
+}
+
+func (q *Queries) CountLiveAuth(ctx context.Context, arg CountLiveAuthParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countLiveAuth, arg.UserID, arg.IdleCutoff, arg.LifetimeCutoff)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createAuth = `-- name: CreateAuth :one
 INSERT INTO
-    auth (user_email)
-VALUES ($1)
-    RETURNING auth_id, user_email, auth_uuid
+    auth (user_id, ip_address, user_agent, device_name, client_id, scope, created_at, last_used_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $7)
+    RETURNING auth_id, auth_uuid, user_id, created_at, last_used_at, ip_address, user_agent, device_name, client_id, scope
 `
 
-func (q *Queries) CreateAuth(ctx context.Context, userEmail string) (Auth, error) {
-	row := q.db.QueryRowContext(ctx, createAuth, userEmail)
+type CreateAuthParams struct {
+	UserID     int32
+	IpAddress  string
+	UserAgent  string
+	DeviceName string
+	ClientID   sql.NullString
+	Scope      string
+	CreatedAt  time.Time
+}
+
+func (q *Queries) CreateAuth(ctx context.Context, arg CreateAuthParams) (Auth, error) {
+	row := q.db.QueryRowContext(ctx, createAuth,
+		arg.UserID,
+		arg.IpAddress,
+		arg.UserAgent,
+		arg.DeviceName,
+		arg.ClientID,
+		arg.Scope,
+		arg.CreatedAt,
+	)
 	var i Auth
-	err := row.Scan(&i.AuthID, &i.UserEmail, &i.AuthUuid)
+	err := row.Scan(
+		&i.AuthID,
+		&i.AuthUuid,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.IpAddress,
+		&i.UserAgent,
+		&i.DeviceName,
+		&i.ClientID,
+		&i.Scope,
+	)
 	return i, err
 }
 
 const deleteAllAuth = `-- name: DeleteAllAuth :exec
 DELETE FROM auth
 WHERE
-    user_email = $1
+    user_id = $1
 `
 
-func (q *Queries) DeleteAllAuth(ctx context.Context, userEmail string) error {
-	_, err := q.db.ExecContext(ctx, deleteAllAuth, userEmail)
+func (q *Queries) DeleteAllAuth(ctx context.Context, userID int32) error {
+	_, err := q.db.ExecContext(ctx, deleteAllAuth, userID)
 	return err
 }
 
-const deleteAuth = `-- name: DeleteAuth :exec
+const deleteAuth = `-- name: DeleteAuth :execrows
 DELETE FROM auth
 WHERE
-    user_email = $1
+    user_id = $1
     AND auth_uuid = $2
 `
 
 type DeleteAuthParams struct {
-	UserEmail string
-	AuthUuid  uuid.UUID
+	UserID   int32
+	AuthUuid uuid.UUID
 }
 
-func (q *Queries) DeleteAuth(ctx context.Context, arg DeleteAuthParams) error {
-	_, err := q.db.ExecContext(ctx, deleteAuth, arg.UserEmail, arg.AuthUuid)
-	return err
+func (q *Queries) DeleteAuth(ctx context.Context, arg DeleteAuthParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAuth, arg.UserID, arg.AuthUuid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteAuthByID = `-- name: DeleteAuthByID :execrows
+DELETE FROM auth
+WHERE
+    auth_id = $1
+`
+
+func (q *Queries) DeleteAuthByID(ctx context.Context, authID int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteAuthByID, authID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteExpiredAuth = `-- name: DeleteExpiredAuth :execrows
+DELETE FROM auth
+WHERE
+    auth_id IN (
+        SELECT auth_id FROM auth
+        WHERE
+            last_used_at < $1
+            OR created_at < $2
+        LIMIT $3
+    )
+`
+
+type DeleteExpiredAuthParams struct {
+	IdleCutoff     time.Time
+	LifetimeCutoff time.Time
+	RowLimit       int32
+}
+
+func (q *Queries) DeleteExpiredAuth(ctx context.Context, arg DeleteExpiredAuthParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredAuth, arg.IdleCutoff, arg.LifetimeCutoff, arg.RowLimit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteLeastRecentlyUsedAuth = `-- name: DeleteLeastRecentlyUsedAuth :execrows
+DELETE FROM auth
+WHERE
+    auth_id IN (
+        SELECT auth_id FROM auth
+        WHERE
+            user_id = $1
+            AND client_id IS NULL
+            AND last_used_at >= $2
+            AND created_at >= $3
+        ORDER BY last_used_at, auth_id
+        LIMIT $4
+    )
+`
+
+type DeleteLeastRecentlyUsedAuthParams struct {
+	UserID         int32
+	IdleCutoff     time.Time
+	LifetimeCutoff time.Time
+	RowLimit       int32
+}
+
+func (q *Queries) DeleteLeastRecentlyUsedAuth(ctx context.Context, arg DeleteLeastRecentlyUsedAuthParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteLeastRecentlyUsedAuth,
+		arg.UserID,
+		arg.IdleCutoff,
+		arg.LifetimeCutoff,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteOtherAuth = `-- name: DeleteOtherAuth :execrows
+DELETE FROM auth
+WHERE
+    user_id = $1
+    AND auth_uuid <> $2
+`
+
+type DeleteOtherAuthParams struct {
+	UserID   int32
+	AuthUuid uuid.UUID
+}
+
+func (q *Queries) DeleteOtherAuth(ctx context.Context, arg DeleteOtherAuthParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOtherAuth, arg.UserID, arg.AuthUuid)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteUserAuthByID = `-- name: DeleteUserAuthByID :execrows
+DELETE FROM auth
+WHERE
+    auth_id = $1
+    AND user_id = $2
+`
+
+type DeleteUserAuthByIDParams struct {
+	AuthID int32
+	UserID int32
+}
+
+func (q *Queries) DeleteUserAuthByID(ctx context.Context, arg DeleteUserAuthByIDParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUserAuthByID, arg.AuthID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getAuth = `-- name: GetAuth :one
-SELECT auth_id, user_email, auth_uuid FROM auth
+SELECT auth_id, auth_uuid, user_id, created_at, last_used_at, ip_address, user_agent, device_name, client_id, scope FROM auth
+WHERE
+    user_id = $1
+`
+
+func (q *Queries) GetAuth(ctx context.Context, userID int32) (Auth, error) {
+	row := q.db.QueryRowContext(ctx, getAuth, userID)
+	var i Auth
+	err := row.Scan(
+		&i.AuthID,
+		&i.AuthUuid,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.IpAddress,
+		&i.UserAgent,
+		&i.DeviceName,
+		&i.ClientID,
+		&i.Scope,
+	)
+	return i, err
+}
+
+const getAuthByID = `-- name: GetAuthByID :one
+SELECT auth_id, auth_uuid, user_id, created_at, last_used_at, ip_address, user_agent, device_name, client_id, scope FROM auth
+WHERE
+    auth_id = $1
+`
+
+func (q *Queries) GetAuthByID(ctx context.Context, authID int32) (Auth, error) {
+	row := q.db.QueryRowContext(ctx, getAuthByID, authID)
+	var i Auth
+	err := row.Scan(
+		&i.AuthID,
+		&i.AuthUuid,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.IpAddress,
+		&i.UserAgent,
+		&i.DeviceName,
+		&i.ClientID,
+		&i.Scope,
+	)
+	return i, err
+}
+
+const getAuthByUUID = `-- name: GetAuthByUUID :one
+SELECT auth_id, auth_uuid, user_id, created_at, last_used_at, ip_address, user_agent, device_name, client_id, scope FROM auth
 WHERE
-    user_email = $1
+    user_id = $1
+    AND auth_uuid = $2
 `
 
-func (q *Queries) GetAuth(ctx context.Context, userEmail string) (Auth, error) {
-	row := q.db.QueryRowContext(ctx, getAuth, userEmail)
+type GetAuthByUUIDParams struct {
+	UserID   int32
+	AuthUuid uuid.UUID
+}
+
+func (q *Queries) GetAuthByUUID(ctx context.Context, arg GetAuthByUUIDParams) (Auth, error) {
+	row := q.db.QueryRowContext(ctx, getAuthByUUID, arg.UserID, arg.AuthUuid)
 	var i Auth
-	err := row.Scan(&i.AuthID, &i.UserEmail, &i.AuthUuid)
+	err := row.Scan(
+		&i.AuthID,
+		&i.AuthUuid,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.LastUsedAt,
+		&i.IpAddress,
+		&i.UserAgent,
+		&i.DeviceName,
+		&i.ClientID,
+		&i.Scope,
+	)
 	return i, err
 }
+
+const listAuthByUser = `-- name: ListAuthByUser :many
+SELECT auth_id, auth_uuid, user_id, created_at, last_used_at, ip_address, user_agent, device_name, client_id, scope FROM auth
+WHERE
+    user_id = $1
+ORDER BY last_used_at DESC, auth_id DESC
+`
+
+func (q *Queries) ListAuthByUser(ctx context.Context, userID int32) ([]Auth, error) {
+	rows, err := q.db.QueryContext(ctx, listAuthByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Auth
+	for rows.Next() {
+		var i Auth
+		if err := rows.Scan(
+			&i.AuthID,
+			&i.AuthUuid,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.IpAddress,
+			&i.UserAgent,
+			&i.DeviceName,
+			&i.ClientID,
+			&i.Scope,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const touchAuth = `-- name: TouchAuth :execrows
+UPDATE auth
+SET last_used_at = $1
+WHERE
+    user_id = $2
+    AND auth_uuid = $3
+    AND last_used_at >= $4
+    AND created_at >= $5
+`
+
+type TouchAuthParams struct {
+	LastUsedAt     time.Time
+	UserID         int32
+	AuthUuid       uuid.UUID
+	IdleCutoff     time.Time
+	LifetimeCutoff time.Time
+}
+
+func (q *Queries) TouchAuth(ctx context.Context, arg TouchAuthParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, touchAuth,
+		arg.LastUsedAt,
+		arg.UserID,
+		arg.AuthUuid,
+		arg.IdleCutoff,
+		arg.LifetimeCutoff,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
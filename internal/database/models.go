@@ -5,15 +5,93 @@
 package database
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Auth struct {
-	AuthID    int32
-	UserEmail string
-	AuthUuid  uuid.UUID
+	AuthID     int32
+	AuthUuid   uuid.UUID
+	UserID     int32
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	IpAddress  string
+	UserAgent  string
+	DeviceName string
+	ClientID   sql.NullString
+	Scope      string
+}
+
+type DeviceCode struct {
+	DeviceCodeHash string
+	UserCode       string
+	DeviceName     string
+	UserID         sql.NullInt32
+	Status         string
+	LastPolledAt   sql.NullTime
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+}
+
+type JwtHmacKey struct {
+	Kid        string
+	Secret     []byte
+	CreatedAt  time.Time
+	PromotedAt sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash            string
+	ClientID            string
+	UserID              int32
+	RedirectUri         string
+	RedirectUriExplicit bool
+	Scope               string
+	CodeChallenge       string
+	CreatedAt           time.Time
+	ExpiresAt           time.Time
+	Nonce               string
+}
+
+type OauthClient struct {
+	ClientID         string
+	ClientName       string
+	ClientSecretHash sql.NullString
+	RedirectUris     []string
+	Scopes           []string
+	CreatedAt        time.Time
+	Audience         []string
+}
+
+type PersonalAccessToken struct {
+	PersonalAccessTokenID int32
+	UserID                int32
+	Name                  string
+	TokenHash             string
+	Scopes                []string
+	CreatedAt             time.Time
+	ExpiresAt             sql.NullTime
+	LastUsedAt            sql.NullTime
+}
+
+type RefreshToken struct {
+	RefreshTokenID int32
+	AuthID         int32
+	TokenHash      string
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	UsedAt         sql.NullTime
+}
+
+type ServiceClient struct {
+	ClientID         string
+	ClientName       string
+	ClientSecretHash string
+	Scopes           []string
+	CreatedAt        time.Time
+	Audience         []string
 }
 
 type User struct {
@@ -27,4 +105,16 @@ type User struct {
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 	Verified       bool
+	MaxSessions    sql.NullInt32
+	Role           sql.NullString
+}
+
+type VerificationToken struct {
+	VerificationTokenID int32
+	UserID              int32
+	Purpose             string
+	TokenHash           string
+	CreatedAt           time.Time
+	ExpiresAt           time.Time
+	ConsumedAt          sql.NullTime
 }
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 )
 
@@ -15,7 +16,7 @@ INSERT INTO
     users (email, username, hashed_password, first_name, last_name, date_of_birth)
 VALUES
     ($1, $2, $3, $4, $5, $6)
-RETURNING user_id, email, username, hashed_password, first_name, last_name, date_of_birth, created_at, updated_at, verified
+RETURNING user_id, email, username, hashed_password, first_name, last_name, date_of_birth, created_at, updated_at, verified, max_sessions, role
 `
 
 type CreateUserParams struct {
@@ -48,28 +49,137 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Verified,
+		&i.MaxSessions,
+		&i.Role,
 	)
 	return i, err
 }
 
-const deleteUser = `-- name: DeleteUser :exec
+const deleteUser = `-- name: DeleteUser :execrows
 DELETE
 FROM users
-WHERE email = $1
+WHERE user_id = $1
 `
 
-func (q *Queries) DeleteUser(ctx context.Context, email string) error {
-	_, err := q.db.ExecContext(ctx, deleteUser, email)
-	return err
+func (q *Queries) DeleteUser(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUser, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getHashedPassword = `-- name: GetHashedPassword :one
+SELECT hashed_password
+FROM users
+WHERE lower(email) = lower($1)
+`
+
+func (q *Queries) GetHashedPassword(ctx context.Context, email string) (string, error) {
+	row := q.db.QueryRowContext(ctx, getHashedPassword, email)
+	var hashed_password string
+	err := row.Scan(&hashed_password)
+	return hashed_password, err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT user_id, email, username, hashed_password, first_name, last_name, date_of_birth, created_at, updated_at, verified, max_sessions, role
+FROM users
+WHERE lower(email) = lower($1)
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.Email,
+		&i.Username,
+		&i.HashedPassword,
+		&i.FirstName,
+		&i.LastName,
+		&i.DateOfBirth,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Verified,
+		&i.MaxSessions,
+		&i.Role,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT user_id, email, username, hashed_password, first_name, last_name, date_of_birth, created_at, updated_at, verified, max_sessions, role
+FROM users
+WHERE user_id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, userID int32) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, userID)
+	var i User
+	err := row.Scan(
+		&i.UserID,
+		&i.Email,
+		&i.Username,
+		&i.HashedPassword,
+		&i.FirstName,
+		&i.LastName,
+		&i.DateOfBirth,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Verified,
+		&i.MaxSessions,
+		&i.Role,
+	)
+	return i, err
+}
+
+const isUserVerified = `-- name: IsUserVerified :one
+SELECT verified
+FROM users
+WHERE lower(email) = lower($1)
+`
+
+func (q *Queries) IsUserVerified(ctx context.Context, email string) (bool, error) {
+	row := q.db.QueryRowContext(ctx, isUserVerified, email)
+	var verified bool
+	err := row.Scan(&verified)
+	return verified, err
 }
 
-const getAllUsers = `-- name: GetAllUsers :many
-SELECT user_id, email, username, hashed_password, first_name, last_name, date_of_birth, created_at, updated_at, verified
+const listUsersByCreatedAt = `-- name: ListUsersByCreatedAt :many
+SELECT user_id, email, username, hashed_password, first_name, last_name, date_of_birth, created_at, updated_at, verified, max_sessions, role
 FROM users
+WHERE
+    ($1::BOOLEAN IS NULL OR verified = $1::BOOLEAN)
+    AND ($2::TIMESTAMP IS NULL OR created_at >= $2::TIMESTAMP)
+    AND ($3::TIMESTAMP IS NULL OR created_at < $3::TIMESTAMP)
+    AND (
+        $4::INTEGER IS NULL
+        OR (created_at, user_id) > ($5::TIMESTAMP, $4::INTEGER)
+    )
+ORDER BY created_at, user_id
+LIMIT $6
 `
 
-func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
-	rows, err := q.db.QueryContext(ctx, getAllUsers)
+type ListUsersByCreatedAtParams struct {
+	Verified       sql.NullBool
+	CreatedAfter   sql.NullTime
+	CreatedBefore  sql.NullTime
+	AfterUserID    sql.NullInt32
+	AfterCreatedAt sql.NullTime
+	RowLimit       int32
+}
+
+func (q *Queries) ListUsersByCreatedAt(ctx context.Context, arg ListUsersByCreatedAtParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersByCreatedAt,
+		arg.Verified,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.AfterUserID,
+		arg.AfterCreatedAt,
+		arg.RowLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -88,6 +198,8 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Verified,
+			&i.MaxSessions,
+			&i.Role,
 		); err != nil {
 			return nil, err
 		}
@@ -102,27 +214,273 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 	return items, nil
 }
 
-const getHashedPassword = `-- name: GetHashedPassword :one
-SELECT hashed_password
+const listUsersByCreatedAtDesc = `-- name: ListUsersByCreatedAtDesc :many
+SELECT user_id, email, username, hashed_password, first_name, last_name, date_of_birth, created_at, updated_at, verified, max_sessions, role
 FROM users
-WHERE email = $1
+WHERE
+    ($1::BOOLEAN IS NULL OR verified = $1::BOOLEAN)
+    AND ($2::TIMESTAMP IS NULL OR created_at >= $2::TIMESTAMP)
+    AND ($3::TIMESTAMP IS NULL OR created_at < $3::TIMESTAMP)
+    AND (
+        $4::INTEGER IS NULL
+        OR (created_at, user_id) < ($5::TIMESTAMP, $4::INTEGER)
+    )
+ORDER BY created_at DESC, user_id DESC
+LIMIT $6
 `
 
-func (q *Queries) GetHashedPassword(ctx context.Context, email string) (string, error) {
-	row := q.db.QueryRowContext(ctx, getHashedPassword, email)
-	var hashed_password string
-	err := row.Scan(&hashed_password)
-	return hashed_password, err
+type ListUsersByCreatedAtDescParams struct {
+	Verified       sql.NullBool
+	CreatedAfter   sql.NullTime
+	CreatedBefore  sql.NullTime
+	AfterUserID    sql.NullInt32
+	AfterCreatedAt sql.NullTime
+	RowLimit       int32
 }
 
-const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT user_id, email, username, hashed_password, first_name, last_name, date_of_birth, created_at, updated_at, verified
+func (q *Queries) ListUsersByCreatedAtDesc(ctx context.Context, arg ListUsersByCreatedAtDescParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersByCreatedAtDesc,
+		arg.Verified,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.AfterUserID,
+		arg.AfterCreatedAt,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Email,
+			&i.Username,
+			&i.HashedPassword,
+			&i.FirstName,
+			&i.LastName,
+			&i.DateOfBirth,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Verified,
+			&i.MaxSessions,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersByUsername = `-- name: ListUsersByUsername :many
+SELECT user_id, email, username, hashed_password, first_name, last_name, date_of_birth, created_at, updated_at, verified, max_sessions, role
 FROM users
-WHERE email = $1
+WHERE
+    ($1::BOOLEAN IS NULL OR verified = $1::BOOLEAN)
+    AND ($2::TIMESTAMP IS NULL OR created_at >= $2::TIMESTAMP)
+    AND ($3::TIMESTAMP IS NULL OR created_at < $3::TIMESTAMP)
+    AND (
+        $4::INTEGER IS NULL
+        OR (username, user_id) > ($5::VARCHAR, $4::INTEGER)
+    )
+ORDER BY username, user_id
+LIMIT $6
 `
 
-func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
-	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+type ListUsersByUsernameParams struct {
+	Verified      sql.NullBool
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+	AfterUserID   sql.NullInt32
+	AfterUsername sql.NullString
+	RowLimit      int32
+}
+
+func (q *Queries) ListUsersByUsername(ctx context.Context, arg ListUsersByUsernameParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersByUsername,
+		arg.Verified,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.AfterUserID,
+		arg.AfterUsername,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Email,
+			&i.Username,
+			&i.HashedPassword,
+			&i.FirstName,
+			&i.LastName,
+			&i.DateOfBirth,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Verified,
+			&i.MaxSessions,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersByUsernameDesc = `-- name: ListUsersByUsernameDesc :many
+SELECT user_id, email, username, hashed_password, first_name, last_name, date_of_birth, created_at, updated_at, verified, max_sessions, role
+FROM users
+WHERE
+    ($1::BOOLEAN IS NULL OR verified = $1::BOOLEAN)
+    AND ($2::TIMESTAMP IS NULL OR created_at >= $2::TIMESTAMP)
+    AND ($3::TIMESTAMP IS NULL OR created_at < $3::TIMESTAMP)
+    AND (
+        $4::INTEGER IS NULL
+        OR (username, user_id) < ($5::VARCHAR, $4::INTEGER)
+    )
+ORDER BY username DESC, user_id DESC
+LIMIT $6
+`
+
+type ListUsersByUsernameDescParams struct {
+	Verified      sql.NullBool
+	CreatedAfter  sql.NullTime
+	CreatedBefore sql.NullTime
+	AfterUserID   sql.NullInt32
+	AfterUsername sql.NullString
+	RowLimit      int32
+}
+
+func (q *Queries) ListUsersByUsernameDesc(ctx context.Context, arg ListUsersByUsernameDescParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersByUsernameDesc,
+		arg.Verified,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+		arg.AfterUserID,
+		arg.AfterUsername,
+		arg.RowLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []User
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Email,
+			&i.Username,
+			&i.HashedPassword,
+			&i.FirstName,
+			&i.LastName,
+			&i.DateOfBirth,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Verified,
+			&i.MaxSessions,
+			&i.Role,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setUserMaxSessions = `-- name: SetUserMaxSessions :execrows
+UPDATE users
+SET max_sessions = $1
+WHERE user_id = $2
+`
+
+type SetUserMaxSessionsParams struct {
+	MaxSessions sql.NullInt32
+	UserID      int32
+}
+
+func (q *Queries) SetUserMaxSessions(ctx context.Context, arg SetUserMaxSessionsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserMaxSessions, arg.MaxSessions, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserRole = `-- name: SetUserRole :execrows
+UPDATE users
+SET role = $1
+WHERE user_id = $2
+`
+
+type SetUserRoleParams struct {
+	Role   sql.NullString
+	UserID int32
+}
+
+func (q *Queries) SetUserRole(ctx context.Context, arg SetUserRoleParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserRole, arg.Role, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET
+    username = COALESCE($1, username),
+    first_name = COALESCE($2, first_name),
+    last_name = COALESCE($3, last_name),
+    date_of_birth = COALESCE($4, date_of_birth),
+    updated_at = CURRENT_TIMESTAMP
+WHERE user_id = $5
+RETURNING user_id, email, username, hashed_password, first_name, last_name, date_of_birth, created_at, updated_at, verified, max_sessions, role
+`
+
+type UpdateUserParams struct {
+	Username    sql.NullString
+	FirstName   sql.NullString
+	LastName    sql.NullString
+	DateOfBirth sql.NullTime
+	UserID      int32
+}
+
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser,
+		arg.Username,
+		arg.FirstName,
+		arg.LastName,
+		arg.DateOfBirth,
+		arg.UserID,
+	)
 	var i User
 	err := row.Scan(
 		&i.UserID,
@@ -135,30 +493,22 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Verified,
+		&i.MaxSessions,
+		&i.Role,
 	)
 	return i, err
 }
 
-const isUserVerified = `-- name: IsUserVerified :one
-SELECT verified
-FROM users
-WHERE email = $1
-`
-
-func (q *Queries) IsUserVerified(ctx context.Context, email string) (bool, error) {
-	row := q.db.QueryRowContext(ctx, isUserVerified, email)
-	var verified bool
-	err := row.Scan(&verified)
-	return verified, err
-}
-
-const verifyUser = `-- name: VerifyUser :exec
+const verifyUser = `-- name: VerifyUser :execrows
 UPDATE users
 SET verified = TRUE
-WHERE email = $1
+WHERE user_id = $1
 `
 
-func (q *Queries) VerifyUser(ctx context.Context, email string) error {
-	_, err := q.db.ExecContext(ctx, verifyUser, email)
-	return err
+func (q *Queries) VerifyUser(ctx context.Context, userID int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, verifyUser, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
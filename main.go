@@ -1,21 +1,42 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
 
 	"github.com/yuanzix/userAuth/handlers"
 	"github.com/yuanzix/userAuth/utils"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	store, err1 := utils.NewPostgresStore()
-	_, err2 := utils.ReadJWTSecret()
+	keys, err2 := utils.ReadKeyRing()
 	_, _, err3 := utils.ReadGmailDetails()
 	_, err4 := utils.ReadBackendURL()
-	if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
-		log.Fatal(err1, err2, err3, err4)
+	settings, err5 := utils.ReadSettings()
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
+		log.Fatal(err1, err2, err3, err4, err5)
+	}
+	// ID tokens name the issuer, which relying parties compare against the one they expect
+	if keys.CanSignIDTokens() && settings.Issuer == "" {
+		log.Fatal("OpenID Connect needs an issuer, set OIDC_ISSUER or BACKEND_URL")
+	}
+
+	if err := keys.ReloadHMACKeys(context.Background(), store); err != nil {
+		log.Fatal(err)
+	}
+	if !keys.CanSign() {
+		log.Fatal("missing required environment variable JWT_SIGNING_KEY_FILE or JWT_SECRET, or a signing key added with userAuth keys")
 	}
 
-	server := handlers.NewAPIServer(":3000", store)
+	server := handlers.NewAPIServer(":3000", store, keys, settings)
 	server.Run()
 }
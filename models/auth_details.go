@@ -1,8 +1,31 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Who a token speaks for
+type Principal string
+
+const (
+	// A user, through a session, an OAuth grant or a personal access token
+	PrincipalUser Principal = "user"
+	// A service client acting as itself. Only ClientID, Scope and ExpiresAt are set.
+	PrincipalClient Principal = "client"
+)
 
 type AuthDetails struct {
-	UserEmail string
+	Principal Principal
+	UserID    int32
 	AuthUUID  uuid.UUID
+	// The OAuth client the session was granted to, empty for first-party sessions
+	ClientID string
+	Scope    string
+	// When the access token the details were read from expires
+	ExpiresAt time.Time
+	// Set instead of AuthUUID when the request was made with a personal access token,
+	// whose scopes are then in Scope
+	PersonalAccessTokenID int32
 }
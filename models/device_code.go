@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// The states of a device code, in the status column
+const (
+	DeviceCodePending  = "pending"
+	DeviceCodeApproved = "approved"
+	DeviceCodeDenied   = "denied"
+)
+
+type DeviceCode struct {
+	DeviceCodeHash string
+	// What the user types on the verification page, as XXXX-XXXX
+	UserCode   string
+	DeviceName string
+	ExpiresAt  time.Time
+}
+
+// Returned to the device when it starts the flow (RFC 8628 section 3.2)
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	// Seconds the device must wait between polls of the token endpoint
+	Interval int64 `json:"interval"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// A client registered to use userAuth as its authorization server. Public clients have no SecretHash.
+type OAuthClient struct {
+	ClientID     string
+	Name         string
+	SecretHash   string
+	RedirectURIs []string
+	Scopes       []string
+	// Added to the aud claim of the client's tokens, for the resource servers it calls
+	Audience []string
+}
+
+// A backend service that calls the API as itself through the client_credentials grant
+type ServiceClient struct {
+	ClientID   string
+	Name       string
+	SecretHash string
+	Scopes     []string
+	// Added to the aud claim of the client's tokens, for the resource servers it calls
+	Audience []string
+}
+
+type AuthorizationCode struct {
+	CodeHash    string
+	ClientID    string
+	UserID      int32
+	RedirectURI string
+	// Whether the authorization request named RedirectURI, which the token request must then repeat
+	RedirectURIExplicit bool
+	Scope               string
+	// The S256 PKCE challenge the code verifier is checked against
+	CodeChallenge string
+	// OpenID Connect nonce to repeat in the ID token
+	Nonce     string
+	ExpiresAt time.Time
+}
+
+// Successful token endpoint response (RFC 6749 section 5.1)
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	// Only for clients granted the openid scope
+	IDToken string `json:"id_token,omitempty"`
+}
+
+// Error response of the token endpoint (RFC 6749 section 5.2)
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// Token introspection response (RFC 7662 section 2.2). Inactive tokens only report active.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Subject   string `json:"sub,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Scope     string `json:"scope,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/yuanzix/userAuth/internal/database"
+)
+
+// A token a user creates so scripts can call the API without their password.
+// A zero ExpiresAt means the token does not expire.
+type PersonalAccessToken struct {
+	UserID    int32
+	Name      string
+	TokenHash string
+	Scopes    []string
+	ExpiresAt time.Time
+}
+
+type PersonalAccessTokenResponse struct {
+	ID         int32      `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	// Only returned when the token is created, it cannot be retrieved later
+	Token string `json:"token,omitempty"`
+}
+
+func DatabasePersonalAccessTokenToResponse(t *database.PersonalAccessToken) PersonalAccessTokenResponse {
+	response := PersonalAccessTokenResponse{
+		ID:        t.PersonalAccessTokenID,
+		Name:      t.Name,
+		Scopes:    t.Scopes,
+		CreatedAt: t.CreatedAt,
+	}
+	if t.ExpiresAt.Valid {
+		response.ExpiresAt = &t.ExpiresAt.Time
+	}
+	if t.LastUsedAt.Valid {
+		response.LastUsedAt = &t.LastUsedAt.Time
+	}
+
+	return response
+}
+
+func DatabasePersonalAccessTokensToResponses(dbTokens *[]database.PersonalAccessToken) *[]PersonalAccessTokenResponse {
+	tokens := []PersonalAccessTokenResponse{}
+
+	for _, dbToken := range *dbTokens {
+		tokens = append(tokens, DatabasePersonalAccessTokenToResponse(&dbToken))
+	}
+
+	return &tokens
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yuanzix/userAuth/internal/database"
+)
+
+// Where a session was started from, recorded when the auth row is created
+type SessionMetadata struct {
+	IPAddress  string
+	UserAgent  string
+	DeviceName string
+	// Set when the session was granted to an OAuth client, along with the scope it was granted
+	ClientID string
+	Scope    string
+}
+
+type SessionResponse struct {
+	ID         int32     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	DeviceName string    `json:"device_name,omitempty"`
+	ClientID   string    `json:"client_id,omitempty"`
+	Scope      string    `json:"scope,omitempty"`
+	// Whether this is the session the request was made with
+	Current bool `json:"current"`
+}
+
+func DatabaseAuthToSessionResponse(a *database.Auth, currentAuthUUID uuid.UUID) SessionResponse {
+	return SessionResponse{
+		ID:         a.AuthID,
+		CreatedAt:  a.CreatedAt,
+		LastUsedAt: a.LastUsedAt,
+		IPAddress:  a.IpAddress,
+		UserAgent:  a.UserAgent,
+		DeviceName: a.DeviceName,
+		ClientID:   a.ClientID.String,
+		Scope:      a.Scope,
+		Current:    a.AuthUuid == currentAuthUUID,
+	}
+}
+
+func DatabaseAuthsToSessionResponses(dbAuths *[]database.Auth, currentAuthUUID uuid.UUID) *[]SessionResponse {
+	sessions := []SessionResponse{}
+
+	for _, dbAuth := range *dbAuths {
+		sessions = append(sessions, DatabaseAuthToSessionResponse(&dbAuth, currentAuthUUID))
+	}
+
+	return &sessions
+}
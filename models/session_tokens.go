@@ -0,0 +1,16 @@
+package models
+
+// The token pair handed out when a session is created or refreshed. Browser clients
+// using cookie sessions get the tokens as cookies and only see the CSRF token.
+type SessionTokens struct {
+	AccessToken  string `json:"token_string,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	CSRFToken    string `json:"csrf_token,omitempty"`
+	// Lifetime of the access token in seconds
+	ExpiresIn int64 `json:"expires_in"`
+}
+
+type LoginResponse struct {
+	Login string `json:"login"`
+	SessionTokens
+}
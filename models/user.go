@@ -16,10 +16,41 @@ type User struct {
 }
 
 type UserResponse struct {
-	Email     string `json:"email"`
-	Username  string `json:"username"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
+	Email     string    `json:"email"`
+	Username  string    `json:"username"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Verified  bool      `json:"verified"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type UserListResponse struct {
+	Users      *[]UserResponse `json:"users"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+// Columns users can be listed by. Ties are always broken by user_id.
+const (
+	UserSortCreatedAt = "created_at"
+	UserSortUsername  = "username"
+)
+
+type UserListParams struct {
+	Limit         int32
+	SortBy        string
+	Descending    bool
+	Verified      *bool
+	CreatedAfter  *time.Time // inclusive
+	CreatedBefore *time.Time // exclusive
+	After         *UserCursor
+}
+
+// UserCursor is the position of the last user on the previous page.
+// Only the value of the column being sorted on is used.
+type UserCursor struct {
+	UserID    int32
+	CreatedAt time.Time
+	Username  string
 }
 
 func DatabaseUserToUserResponse(u *database.User) UserResponse {
@@ -28,6 +59,8 @@ func DatabaseUserToUserResponse(u *database.User) UserResponse {
 		Username:  u.Username,
 		FirstName: u.FirstName,
 		LastName:  u.LastName,
+		Verified:  u.Verified,
+		CreatedAt: u.CreatedAt,
 	}
 }
 
@@ -0,0 +1,6 @@
+package models
+
+// What a verification token may be used for. A token is only accepted by the flow matching its purpose.
+const (
+	VerificationPurposeEmail = "verify_email"
+)
@@ -0,0 +1,23 @@
+-- +goose Up
+-- Listing filters and cursors are compared in UTC. Rows written with the database's local
+-- CURRENT_TIMESTAMP are converted, and the default now gives UTC too.
+UPDATE users
+SET created_at = created_at AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC';
+
+ALTER TABLE users
+ALTER created_at SET DEFAULT (now() AT TIME ZONE 'UTC');
+
+CREATE INDEX users_created_at_user_id_idx ON users (created_at, user_id);
+
+CREATE INDEX users_username_user_id_idx ON users (username, user_id);
+
+-- +goose Down
+DROP INDEX users_username_user_id_idx;
+
+DROP INDEX users_created_at_user_id_idx;
+
+ALTER TABLE users
+ALTER created_at SET DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE users
+SET created_at = created_at AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone');
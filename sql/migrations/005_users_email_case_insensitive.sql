@@ -0,0 +1,15 @@
+-- +goose Up
+-- Fails if the table already holds addresses that only differ by case, those have to be merged by hand first
+ALTER TABLE users
+DROP CONSTRAINT users_email_key;
+
+CREATE UNIQUE INDEX users_email_lower_key ON users (lower(email));
+
+CREATE INDEX auth_user_email_lower_idx ON auth (lower(user_email));
+
+-- +goose Down
+DROP INDEX auth_user_email_lower_idx;
+
+DROP INDEX users_email_lower_key;
+
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
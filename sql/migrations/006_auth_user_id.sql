@@ -0,0 +1,40 @@
+-- +goose Up
+ALTER TABLE auth ADD user_id INTEGER;
+
+UPDATE auth
+SET user_id = users.user_id
+FROM users
+WHERE lower(users.email) = lower(auth.user_email);
+
+-- Sessions whose user has already been deleted
+DELETE FROM auth
+WHERE user_id IS NULL;
+
+ALTER TABLE auth
+ALTER COLUMN user_id SET NOT NULL,
+ADD CONSTRAINT auth_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE;
+
+DROP INDEX auth_user_email_lower_idx;
+
+ALTER TABLE auth
+DROP COLUMN user_email;
+
+CREATE INDEX auth_user_id_auth_uuid_idx ON auth (user_id, auth_uuid);
+
+-- +goose Down
+ALTER TABLE auth ADD user_email VARCHAR(50);
+
+UPDATE auth
+SET user_email = users.email
+FROM users
+WHERE users.user_id = auth.user_id;
+
+ALTER TABLE auth
+ALTER COLUMN user_email SET NOT NULL;
+
+CREATE INDEX auth_user_email_lower_idx ON auth (lower(user_email));
+
+DROP INDEX auth_user_id_auth_uuid_idx;
+
+ALTER TABLE auth
+DROP COLUMN user_id;
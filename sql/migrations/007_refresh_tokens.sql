@@ -0,0 +1,17 @@
+-- +goose Up
+-- Every refresh token issued for a session belongs to the same family, so deleting
+-- the auth row revokes the session's access tokens and all of its refresh tokens.
+CREATE TABLE
+    refresh_tokens (
+        refresh_token_id SERIAL PRIMARY KEY,
+        auth_id INTEGER NOT NULL REFERENCES auth (auth_id) ON DELETE CASCADE,
+        token_hash VARCHAR(64) UNIQUE NOT NULL,
+        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        expires_at TIMESTAMP NOT NULL,
+        used_at TIMESTAMP
+    );
+
+CREATE INDEX refresh_tokens_auth_id_idx ON refresh_tokens (auth_id);
+
+-- +goose Down
+DROP TABLE refresh_tokens;
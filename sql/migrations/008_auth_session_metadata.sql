@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE auth
+ADD created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD last_used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD ip_address VARCHAR(45) NOT NULL DEFAULT '',
+ADD user_agent VARCHAR(512) NOT NULL DEFAULT '',
+ADD device_name VARCHAR(100) NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE auth
+DROP COLUMN created_at,
+DROP COLUMN last_used_at,
+DROP COLUMN ip_address,
+DROP COLUMN user_agent,
+DROP COLUMN device_name;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE
+    verification_tokens (
+        verification_token_id SERIAL PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+        purpose VARCHAR(32) NOT NULL,
+        token_hash VARCHAR(64) UNIQUE NOT NULL,
+        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        expires_at TIMESTAMP NOT NULL,
+        consumed_at TIMESTAMP
+    );
+
+CREATE INDEX verification_tokens_user_id_idx ON verification_tokens (user_id);
+
+-- +goose Down
+DROP TABLE verification_tokens;
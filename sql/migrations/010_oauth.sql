@@ -0,0 +1,40 @@
+-- +goose Up
+-- Public clients, which cannot keep a secret, have no client_secret_hash and rely on PKCE alone
+CREATE TABLE
+    oauth_clients (
+        client_id VARCHAR(64) PRIMARY KEY,
+        client_name VARCHAR(100) NOT NULL,
+        client_secret_hash VARCHAR(64),
+        redirect_uris TEXT[] NOT NULL,
+        scopes TEXT[] NOT NULL DEFAULT '{}',
+        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+
+CREATE TABLE
+    oauth_authorization_codes (
+        code_hash VARCHAR(64) PRIMARY KEY,
+        client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+        user_id INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+        redirect_uri TEXT NOT NULL,
+        -- Whether the authorization request named the redirect URI. Only then must the
+        -- token request repeat it (RFC 6749 section 4.1.3).
+        redirect_uri_explicit BOOLEAN NOT NULL,
+        scope TEXT NOT NULL,
+        code_challenge VARCHAR(128) NOT NULL,
+        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        expires_at TIMESTAMP NOT NULL
+    );
+
+-- Sessions granted to a client are ordinary auth rows that remember who they were granted to
+ALTER TABLE auth
+ADD client_id VARCHAR(64) REFERENCES oauth_clients (client_id) ON DELETE CASCADE,
+ADD scope TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE auth
+DROP COLUMN client_id,
+DROP COLUMN scope;
+
+DROP TABLE oauth_authorization_codes;
+
+DROP TABLE oauth_clients;
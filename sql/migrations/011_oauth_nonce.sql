@@ -0,0 +1,8 @@
+-- +goose Up
+-- The OpenID Connect nonce of the authorization request, repeated in the ID token
+ALTER TABLE oauth_authorization_codes
+ADD nonce TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE oauth_authorization_codes
+DROP COLUMN nonce;
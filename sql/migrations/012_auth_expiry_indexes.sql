@@ -0,0 +1,30 @@
+-- +goose Up
+-- Session timestamps are compared with cutoffs computed in UTC. Rows written with the
+-- database's local CURRENT_TIMESTAMP are converted, and the defaults now give UTC too.
+UPDATE auth
+SET
+    created_at = created_at AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC',
+    last_used_at = last_used_at AT TIME ZONE current_setting('TimeZone') AT TIME ZONE 'UTC';
+
+ALTER TABLE auth
+ALTER created_at SET DEFAULT (now() AT TIME ZONE 'UTC'),
+ALTER last_used_at SET DEFAULT (now() AT TIME ZONE 'UTC');
+
+-- Lets the session reaper find idle and outlived sessions without scanning the table
+CREATE INDEX auth_last_used_at_idx ON auth (last_used_at);
+
+CREATE INDEX auth_created_at_idx ON auth (created_at);
+
+-- +goose Down
+DROP INDEX auth_created_at_idx;
+
+DROP INDEX auth_last_used_at_idx;
+
+ALTER TABLE auth
+ALTER created_at SET DEFAULT CURRENT_TIMESTAMP,
+ALTER last_used_at SET DEFAULT CURRENT_TIMESTAMP;
+
+UPDATE auth
+SET
+    created_at = created_at AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone'),
+    last_used_at = last_used_at AT TIME ZONE 'UTC' AT TIME ZONE current_setting('TimeZone');
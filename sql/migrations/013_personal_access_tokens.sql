@@ -0,0 +1,18 @@
+-- +goose Up
+-- Tokens users create for scripts and CI jobs. A NULL expires_at means the token does not expire.
+CREATE TABLE
+    personal_access_tokens (
+        personal_access_token_id SERIAL PRIMARY KEY,
+        user_id INTEGER NOT NULL REFERENCES users (user_id) ON DELETE CASCADE,
+        name VARCHAR(100) NOT NULL,
+        token_hash VARCHAR(64) UNIQUE NOT NULL,
+        scopes TEXT[] NOT NULL,
+        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        expires_at TIMESTAMP,
+        last_used_at TIMESTAMP
+    );
+
+CREATE INDEX personal_access_tokens_user_id_idx ON personal_access_tokens (user_id);
+
+-- +goose Down
+DROP TABLE personal_access_tokens;
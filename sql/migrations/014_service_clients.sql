@@ -0,0 +1,13 @@
+-- +goose Up
+-- Backend services that call the API as themselves, through the client_credentials grant
+CREATE TABLE
+    service_clients (
+        client_id VARCHAR(64) PRIMARY KEY,
+        client_name VARCHAR(100) NOT NULL,
+        client_secret_hash VARCHAR(64) NOT NULL,
+        scopes TEXT[] NOT NULL DEFAULT '{}',
+        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    );
+
+-- +goose Down
+DROP TABLE service_clients;
@@ -0,0 +1,17 @@
+-- +goose Up
+-- Pending sign-ins of devices that cannot open a browser (RFC 8628). The user approves the
+-- user_code from a browser, after which the device redeems the device_code once.
+CREATE TABLE
+    device_codes (
+        device_code_hash VARCHAR(64) PRIMARY KEY,
+        user_code VARCHAR(16) NOT NULL UNIQUE,
+        device_name VARCHAR(100) NOT NULL DEFAULT '',
+        user_id INTEGER REFERENCES users (user_id) ON DELETE CASCADE,
+        status VARCHAR(16) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'denied')),
+        last_polled_at TIMESTAMP,
+        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        expires_at TIMESTAMP NOT NULL
+    );
+
+-- +goose Down
+DROP TABLE device_codes;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- Overrides MAX_SESSIONS_PER_USER for one user, such as a service account. NULL keeps the
+-- server-wide limit and 0 lifts it.
+ALTER TABLE users ADD max_sessions INTEGER CHECK (max_sessions >= 0);
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN max_sessions;
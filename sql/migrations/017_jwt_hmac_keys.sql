@@ -0,0 +1,14 @@
+-- +goose Up
+-- HMAC secrets tokens are signed and verified with, named by the kid header. The key
+-- promoted most recently signs new tokens, the others are only accepted. Secrets are
+-- encrypted with JWT_KEY_ENCRYPTION_KEY before they are stored.
+CREATE TABLE
+    jwt_hmac_keys (
+        kid VARCHAR(64) PRIMARY KEY,
+        secret BYTEA NOT NULL,
+        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        promoted_at TIMESTAMP
+    );
+
+-- +goose Down
+DROP TABLE jwt_hmac_keys;
@@ -0,0 +1,18 @@
+-- +goose Up
+-- Named in the role claim of the user's tokens when TOKEN_CLAIMS asks for it
+ALTER TABLE users ADD role VARCHAR(64);
+
+-- Added to the aud claim of the tokens issued to the client, next to TOKEN_AUDIENCE
+ALTER TABLE oauth_clients ADD audience TEXT[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE service_clients ADD audience TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose Down
+ALTER TABLE service_clients
+DROP COLUMN audience;
+
+ALTER TABLE oauth_clients
+DROP COLUMN audience;
+
+ALTER TABLE users
+DROP COLUMN role;
@@ -0,0 +1,7 @@
+// Package migrations embeds the goose-annotated schema so the binary can apply it without goose installed.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
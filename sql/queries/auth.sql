@@ -1,29 +1,105 @@
 -- name: CreateAuth :one
 INSERT INTO
-    auth (user_email)
-VALUES ($1)
+    auth (user_id, ip_address, user_agent, device_name, client_id, scope, created_at, last_used_at)
+VALUES ($1, $2, $3, $4, $5, $6, sqlc.arg('created_at'), sqlc.arg('created_at'))
     RETURNING *;
 
 -- name: GetAuth :one
 SELECT * FROM auth
 WHERE
-    user_email = $1;
+    user_id = $1;
+
+-- name: GetAuthByID :one
+SELECT * FROM auth
+WHERE
+    auth_id = $1;
+
+-- name: GetAuthByUUID :one
+SELECT * FROM auth
+WHERE
+    user_id = $1
+    AND auth_uuid = $2;
+
+-- name: ListAuthByUser :many
+SELECT * FROM auth
+WHERE
+    user_id = $1
+ORDER BY last_used_at DESC, auth_id DESC;
 
 -- name: DeleteAllAuth :exec
 DELETE FROM auth
 WHERE
-    user_email = $1;
+    user_id = $1;
 
--- name: DeleteAuth :exec
+-- name: DeleteAuth :execrows
 DELETE FROM auth
 WHERE
-    user_email = $1
+    user_id = $1
     AND auth_uuid = $2;
 
+-- name: DeleteAuthByID :execrows
+DELETE FROM auth
+WHERE
+    auth_id = $1;
+
+-- name: DeleteUserAuthByID :execrows
+DELETE FROM auth
+WHERE
+    auth_id = $1
+    AND user_id = $2;
+
+-- name: DeleteOtherAuth :execrows
+DELETE FROM auth
+WHERE
+    user_id = $1
+    AND auth_uuid <> $2;
+
 -- name: CheckAuthExists :one
 SELECT EXISTS(
     SELECT * FROM auth
     WHERE
-        user_email = $1
+        user_id = $1
         AND auth_uuid = $2
-);
\ No newline at end of file
+);
+
+-- name: TouchAuth :execrows
+UPDATE auth
+SET last_used_at = sqlc.arg('last_used_at')
+WHERE
+    user_id = sqlc.arg('user_id')
+    AND auth_uuid = sqlc.arg('auth_uuid')
+    AND last_used_at >= sqlc.arg('idle_cutoff')
+    AND created_at >= sqlc.arg('lifetime_cutoff');
+
+-- name: DeleteExpiredAuth :execrows
+DELETE FROM auth
+WHERE
+    auth_id IN (
+        SELECT auth_id FROM auth
+        WHERE
+            last_used_at < sqlc.arg('idle_cutoff')
+            OR created_at < sqlc.arg('lifetime_cutoff')
+        LIMIT sqlc.arg('row_limit')
+    );
+
+-- name: CountLiveAuth :one
+SELECT COUNT(*) FROM auth
+WHERE
+    user_id = sqlc.arg('user_id')
+    AND client_id IS NULL
+    AND last_used_at >= sqlc.arg('idle_cutoff')
+    AND created_at >= sqlc.arg('lifetime_cutoff');
+
+-- name: DeleteLeastRecentlyUsedAuth :execrows
+DELETE FROM auth
+WHERE
+    auth_id IN (
+        SELECT auth_id FROM auth
+        WHERE
+            user_id = sqlc.arg('user_id')
+            AND client_id IS NULL
+            AND last_used_at >= sqlc.arg('idle_cutoff')
+            AND created_at >= sqlc.arg('lifetime_cutoff')
+        ORDER BY last_used_at, auth_id
+        LIMIT sqlc.arg('row_limit')
+    );
@@ -0,0 +1,49 @@
+-- name: CreateDeviceCode :exec
+INSERT INTO
+    device_codes (device_code_hash, user_code, device_name, expires_at)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetDeviceCode :one
+SELECT * FROM device_codes
+WHERE
+    device_code_hash = $1;
+
+-- name: GetPendingDeviceCode :one
+SELECT * FROM device_codes
+WHERE
+    user_code = $1
+    AND status = 'pending'
+    AND expires_at > $2;
+
+-- name: DecideDeviceCode :execrows
+UPDATE device_codes
+SET
+    status = $2,
+    user_id = $3
+WHERE
+    user_code = $1
+    AND status = 'pending'
+    AND expires_at > $4;
+
+-- name: DeleteExpiredDeviceCodes :execrows
+DELETE FROM device_codes
+WHERE
+    device_code_hash IN (
+        SELECT device_code_hash FROM device_codes
+        WHERE
+            expires_at < sqlc.arg('cutoff')
+        LIMIT sqlc.arg('row_limit')
+    );
+
+-- name: MarkDeviceCodePolled :exec
+UPDATE device_codes
+SET
+    last_polled_at = $2
+WHERE
+    device_code_hash = $1;
+
+-- name: ConsumeDeviceCode :one
+DELETE FROM device_codes
+WHERE
+    device_code_hash = $1
+    RETURNING *;
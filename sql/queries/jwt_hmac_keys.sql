@@ -0,0 +1,21 @@
+-- name: CreateHMACKey :one
+INSERT INTO
+    jwt_hmac_keys (kid, secret)
+VALUES ($1, $2)
+    RETURNING *;
+
+-- name: ListHMACKeys :many
+SELECT * FROM jwt_hmac_keys
+ORDER BY created_at, kid;
+
+-- name: PromoteHMACKey :execrows
+UPDATE jwt_hmac_keys
+SET
+    promoted_at = $2
+WHERE
+    kid = $1;
+
+-- name: RetireHMACKey :execrows
+DELETE FROM jwt_hmac_keys
+WHERE
+    kid = $1;
@@ -0,0 +1,41 @@
+-- name: CreateOAuthClient :one
+INSERT INTO
+    oauth_clients (client_id, client_name, client_secret_hash, redirect_uris, scopes, audience)
+VALUES ($1, $2, $3, $4, $5, $6)
+    RETURNING *;
+
+-- name: GetOAuthClient :one
+SELECT * FROM oauth_clients
+WHERE
+    client_id = $1;
+
+-- name: ListOAuthClients :many
+SELECT * FROM oauth_clients
+ORDER BY created_at, client_id;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients
+WHERE
+    client_id = $1;
+
+-- name: CreateAuthorizationCode :exec
+INSERT INTO
+    oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, redirect_uri_explicit, scope, code_challenge, expires_at, nonce)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9);
+
+-- name: ConsumeAuthorizationCode :one
+DELETE FROM oauth_authorization_codes
+WHERE
+    code_hash = $1
+    AND expires_at > $2
+    RETURNING *;
+
+-- name: DeleteExpiredAuthorizationCodes :execrows
+DELETE FROM oauth_authorization_codes
+WHERE
+    code_hash IN (
+        SELECT code_hash FROM oauth_authorization_codes
+        WHERE
+            expires_at < sqlc.arg('cutoff')
+        LIMIT sqlc.arg('row_limit')
+    );
@@ -0,0 +1,28 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO
+    personal_access_tokens (user_id, name, token_hash, scopes, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+    RETURNING *;
+
+-- name: ListPersonalAccessTokensByUser :many
+SELECT * FROM personal_access_tokens
+WHERE
+    user_id = $1
+ORDER BY created_at DESC, personal_access_token_id DESC;
+
+-- name: DeleteUserPersonalAccessToken :execrows
+DELETE FROM personal_access_tokens
+WHERE
+    personal_access_token_id = $1
+    AND user_id = $2;
+
+-- name: UsePersonalAccessToken :one
+UPDATE personal_access_tokens
+SET last_used_at = CURRENT_TIMESTAMP
+WHERE
+    token_hash = sqlc.arg('token_hash')
+    AND (
+        expires_at IS NULL
+        OR expires_at > sqlc.arg('now')
+    )
+    RETURNING *;
@@ -0,0 +1,27 @@
+-- name: CreateRefreshToken :one
+INSERT INTO
+    refresh_tokens (auth_id, token_hash, expires_at)
+VALUES ($1, $2, $3)
+    RETURNING *;
+
+-- name: DeleteExpiredRefreshTokens :execrows
+DELETE FROM refresh_tokens
+WHERE
+    refresh_token_id IN (
+        SELECT refresh_token_id FROM refresh_tokens
+        WHERE
+            expires_at < sqlc.arg('cutoff')
+        LIMIT sqlc.arg('row_limit')
+    );
+
+-- name: GetRefreshTokenByHash :one
+SELECT * FROM refresh_tokens
+WHERE
+    token_hash = $1;
+
+-- name: UseRefreshToken :execrows
+UPDATE refresh_tokens
+SET used_at = CURRENT_TIMESTAMP
+WHERE
+    refresh_token_id = $1
+    AND used_at IS NULL;
@@ -0,0 +1,19 @@
+-- name: CreateServiceClient :one
+INSERT INTO
+    service_clients (client_id, client_name, client_secret_hash, scopes, audience)
+VALUES ($1, $2, $3, $4, $5)
+    RETURNING *;
+
+-- name: GetServiceClient :one
+SELECT * FROM service_clients
+WHERE
+    client_id = $1;
+
+-- name: ListServiceClients :many
+SELECT * FROM service_clients
+ORDER BY created_at, client_id;
+
+-- name: DeleteServiceClient :execrows
+DELETE FROM service_clients
+WHERE
+    client_id = $1;
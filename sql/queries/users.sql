@@ -5,31 +5,109 @@ VALUES
     ($1, $2, $3, $4, $5, $6)
 RETURNING *;
 
--- name: GetAllUsers :many
+-- name: GetUserByEmail :one
 SELECT *
-FROM users;
+FROM users
+WHERE lower(email) = lower(sqlc.arg('email'));
 
--- name: GetUserByEmail :one
+-- name: GetUserByID :one
 SELECT *
 FROM users
-WHERE email = $1;
+WHERE user_id = $1;
 
--- name: DeleteUser :exec
+-- name: DeleteUser :execrows
 DELETE
 FROM users
-WHERE email = $1;
+WHERE user_id = $1;
 
 -- name: GetHashedPassword :one
 SELECT hashed_password
 FROM users
-WHERE email = $1;
+WHERE lower(email) = lower(sqlc.arg('email'));
 
--- name: VerifyUser :exec
+-- name: VerifyUser :execrows
 UPDATE users
 SET verified = TRUE
-WHERE email = $1;
+WHERE user_id = $1;
 
 -- name: IsUserVerified :one
 SELECT verified
 FROM users
-WHERE email = $1;
\ No newline at end of file
+WHERE lower(email) = lower(sqlc.arg('email'));
+
+-- name: SetUserMaxSessions :execrows
+UPDATE users
+SET max_sessions = sqlc.narg('max_sessions')
+WHERE user_id = sqlc.arg('user_id');
+
+-- name: SetUserRole :execrows
+UPDATE users
+SET role = sqlc.narg('role')
+WHERE user_id = sqlc.arg('user_id');
+
+-- name: UpdateUser :one
+UPDATE users
+SET
+    username = COALESCE(sqlc.narg('username'), username),
+    first_name = COALESCE(sqlc.narg('first_name'), first_name),
+    last_name = COALESCE(sqlc.narg('last_name'), last_name),
+    date_of_birth = COALESCE(sqlc.narg('date_of_birth'), date_of_birth),
+    updated_at = CURRENT_TIMESTAMP
+WHERE user_id = sqlc.arg('user_id')
+RETURNING *;
+
+-- name: ListUsersByCreatedAt :many
+SELECT *
+FROM users
+WHERE
+    (sqlc.narg('verified')::BOOLEAN IS NULL OR verified = sqlc.narg('verified')::BOOLEAN)
+    AND (sqlc.narg('created_after')::TIMESTAMP IS NULL OR created_at >= sqlc.narg('created_after')::TIMESTAMP)
+    AND (sqlc.narg('created_before')::TIMESTAMP IS NULL OR created_at < sqlc.narg('created_before')::TIMESTAMP)
+    AND (
+        sqlc.narg('after_user_id')::INTEGER IS NULL
+        OR (created_at, user_id) > (sqlc.narg('after_created_at')::TIMESTAMP, sqlc.narg('after_user_id')::INTEGER)
+    )
+ORDER BY created_at, user_id
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListUsersByCreatedAtDesc :many
+SELECT *
+FROM users
+WHERE
+    (sqlc.narg('verified')::BOOLEAN IS NULL OR verified = sqlc.narg('verified')::BOOLEAN)
+    AND (sqlc.narg('created_after')::TIMESTAMP IS NULL OR created_at >= sqlc.narg('created_after')::TIMESTAMP)
+    AND (sqlc.narg('created_before')::TIMESTAMP IS NULL OR created_at < sqlc.narg('created_before')::TIMESTAMP)
+    AND (
+        sqlc.narg('after_user_id')::INTEGER IS NULL
+        OR (created_at, user_id) < (sqlc.narg('after_created_at')::TIMESTAMP, sqlc.narg('after_user_id')::INTEGER)
+    )
+ORDER BY created_at DESC, user_id DESC
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListUsersByUsername :many
+SELECT *
+FROM users
+WHERE
+    (sqlc.narg('verified')::BOOLEAN IS NULL OR verified = sqlc.narg('verified')::BOOLEAN)
+    AND (sqlc.narg('created_after')::TIMESTAMP IS NULL OR created_at >= sqlc.narg('created_after')::TIMESTAMP)
+    AND (sqlc.narg('created_before')::TIMESTAMP IS NULL OR created_at < sqlc.narg('created_before')::TIMESTAMP)
+    AND (
+        sqlc.narg('after_user_id')::INTEGER IS NULL
+        OR (username, user_id) > (sqlc.narg('after_username')::VARCHAR, sqlc.narg('after_user_id')::INTEGER)
+    )
+ORDER BY username, user_id
+LIMIT sqlc.arg('row_limit');
+
+-- name: ListUsersByUsernameDesc :many
+SELECT *
+FROM users
+WHERE
+    (sqlc.narg('verified')::BOOLEAN IS NULL OR verified = sqlc.narg('verified')::BOOLEAN)
+    AND (sqlc.narg('created_after')::TIMESTAMP IS NULL OR created_at >= sqlc.narg('created_after')::TIMESTAMP)
+    AND (sqlc.narg('created_before')::TIMESTAMP IS NULL OR created_at < sqlc.narg('created_before')::TIMESTAMP)
+    AND (
+        sqlc.narg('after_user_id')::INTEGER IS NULL
+        OR (username, user_id) < (sqlc.narg('after_username')::VARCHAR, sqlc.narg('after_user_id')::INTEGER)
+    )
+ORDER BY username DESC, user_id DESC
+LIMIT sqlc.arg('row_limit');
@@ -0,0 +1,26 @@
+-- name: CreateVerificationToken :one
+INSERT INTO
+    verification_tokens (user_id, purpose, token_hash, expires_at)
+VALUES ($1, $2, $3, $4)
+    RETURNING *;
+
+-- name: ConsumeVerificationToken :one
+UPDATE verification_tokens
+SET consumed_at = CURRENT_TIMESTAMP
+WHERE
+    token_hash = $1
+    AND purpose = $2
+    AND consumed_at IS NULL
+    AND expires_at > $3
+    RETURNING *;
+
+-- name: DeleteStaleVerificationTokens :execrows
+DELETE FROM verification_tokens
+WHERE
+    verification_token_id IN (
+        SELECT verification_token_id FROM verification_tokens
+        WHERE
+            consumed_at IS NOT NULL
+            OR expires_at < sqlc.arg('cutoff')
+        LIMIT sqlc.arg('row_limit')
+    );
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Returns the address the request came from. X-Forwarded-For is only honoured when
+// trustProxy is set, since any client can send it when the server is reached directly.
+// Proxies append the address they were reached from, so only the right-most entry,
+// written by the proxy in front of us, can be trusted. The ones before it are whatever
+// the client sent.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		// The header may also be split across several lines, the last of which is the proxy's
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			forwarded := values[len(values)-1]
+			last := forwarded[strings.LastIndex(forwarded, ",")+1:]
+			if ip := net.ParseIP(strings.TrimSpace(last)); ip != nil {
+				return ip.String()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		trustProxy bool
+		want       string
+	}{
+		{"remote address", "203.0.113.7:51234", nil, false, "203.0.113.7"},
+		{"IPv6 remote address", "[2001:db8::1]:51234", nil, false, "2001:db8::1"},
+		{"remote address without a port", "203.0.113.7", nil, false, "203.0.113.7"},
+		{"forwarded but not trusted", "10.0.0.1:51234", []string{"203.0.113.7"}, false, "10.0.0.1"},
+		{"forwarded by the proxy", "10.0.0.1:51234", []string{"203.0.113.7"}, true, "203.0.113.7"},
+		{"client spoofing an address", "10.0.0.1:51234", []string{"198.51.100.1, 203.0.113.7"}, true, "203.0.113.7"},
+		{"header over several lines", "10.0.0.1:51234", []string{"198.51.100.1", "203.0.113.7"}, true, "203.0.113.7"},
+		{"proxy wrote garbage", "10.0.0.1:51234", []string{"203.0.113.7, unknown"}, true, "10.0.0.1"},
+		{"trusted but not forwarded", "10.0.0.1:51234", nil, true, "10.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			if got := ClientIP(r, tt.trustProxy); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
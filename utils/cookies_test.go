@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie string
+		header string
+		form   string
+		ok     bool
+	}{
+		{"header repeats the cookie", "token", "token", "", true},
+		{"form field repeats the cookie", "token", "", "token", true},
+		{"header differs", "token", "other", "", false},
+		{"header is a prefix", "token", "tok", "", false},
+		{"nothing repeated", "token", "", "", false},
+		{"no cookie", "", "token", "", false},
+		{"header and cookie both empty", "", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var r *http.Request
+			if tt.form != "" {
+				r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{CSRFFormField: {tt.form}}.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			} else {
+				r = httptest.NewRequest(http.MethodPost, "/", nil)
+			}
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				r.Header.Set(CSRFHeader, tt.header)
+			}
+
+			if err := CheckCSRF(r); (err == nil) != tt.ok {
+				t.Fatalf("got %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIsCookieAuthenticated(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	if IsCookieAuthenticated(r) {
+		t.Fatal("a request without credentials is cookie authenticated")
+	}
+
+	r.AddCookie(&http.Cookie{Name: AccessTokenCookie, Value: "token"})
+	if !IsCookieAuthenticated(r) {
+		t.Fatal("a request with the access token cookie is not cookie authenticated")
+	}
+
+	// The header is what the server reads first, so a request sending it is not exposed to CSRF
+	r.Header.Set("Authorization", "Bearer token")
+	if IsCookieAuthenticated(r) {
+		t.Fatal("a request with an Authorization header is cookie authenticated")
+	}
+}
+
+func TestIsSafeMethod(t *testing.T) {
+	for method, safe := range map[string]bool{
+		http.MethodGet: true, http.MethodHead: true, http.MethodOptions: true,
+		http.MethodPost: false, http.MethodPut: false, http.MethodPatch: false, http.MethodDelete: false,
+	} {
+		if IsSafeMethod(method) != safe {
+			t.Errorf("IsSafeMethod(%v) = %v", method, !safe)
+		}
+	}
+}
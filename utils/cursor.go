@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/yuanzix/userAuth/internal/database"
+	"github.com/yuanzix/userAuth/models"
+)
+
+type userCursor struct {
+	SortBy     string    `json:"s"`
+	Descending bool      `json:"d"`
+	UserID     int32     `json:"id"`
+	CreatedAt  time.Time `json:"c"`
+	Username   string    `json:"u"`
+}
+
+// Encodes the position of user in the listing described by params as an opaque string
+func EncodeUserCursor(params models.UserListParams, user *database.User) (string, error) {
+	cursor := userCursor{
+		SortBy:     params.SortBy,
+		Descending: params.Descending,
+		UserID:     user.UserID,
+		CreatedAt:  user.CreatedAt,
+		Username:   user.Username,
+	}
+
+	content, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(content), nil
+}
+
+// Decodes a cursor produced by EncodeUserCursor, rejecting cursors from a listing with a different order
+func DecodeUserCursor(params models.UserListParams, cursorString string) (*models.UserCursor, error) {
+	content, err := base64.RawURLEncoding.DecodeString(cursorString)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	cursor := userCursor{}
+	if err := json.Unmarshal(content, &cursor); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+
+	if cursor.SortBy != params.SortBy || cursor.Descending != params.Descending {
+		return nil, errors.New("cursor does not match the requested sort order")
+	}
+
+	return &models.UserCursor{
+		UserID:    cursor.UserID,
+		CreatedAt: cursor.CreatedAt,
+		Username:  cursor.Username,
+	}, nil
+}
@@ -0,0 +1,112 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yuanzix/userAuth/internal/database"
+	"github.com/yuanzix/userAuth/models"
+)
+
+func TestUserCursorRoundTrip(t *testing.T) {
+	params := models.UserListParams{SortBy: models.UserSortUsername, Descending: true}
+	user := &database.User{
+		UserID:    42,
+		Username:  "jane",
+		CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 123456789, time.UTC),
+	}
+
+	cursorString, err := EncodeUserCursor(params, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cursor, err := DecodeUserCursor(params, cursorString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.UserID != user.UserID || cursor.Username != user.Username || !cursor.CreatedAt.Equal(user.CreatedAt) {
+		t.Fatalf("got %+v, want the position of %+v", cursor, user)
+	}
+}
+
+func TestDecodeUserCursorRejects(t *testing.T) {
+	params := models.UserListParams{SortBy: models.UserSortCreatedAt}
+	cursorString, err := EncodeUserCursor(params, &database.User{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		params       models.UserListParams
+		cursorString string
+	}{
+		{"other column", models.UserListParams{SortBy: models.UserSortUsername}, cursorString},
+		{"other direction", models.UserListParams{SortBy: models.UserSortCreatedAt, Descending: true}, cursorString},
+		{"not base64", params, "not a cursor!"},
+		{"not JSON", params, "bm90IGpzb24"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeUserCursor(tt.params, tt.cursorString); err == nil {
+				t.Fatal("the cursor was accepted")
+			}
+		})
+	}
+}
+
+// Pages through users sharing a username, which only the user id tells apart
+func TestUserCursorPaging(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	for i := 0; i < 7; i++ {
+		user := models.User{Email: fmt.Sprintf("user%v@example.com", i), Username: []string{"ann", "bob"}[i%2]}
+		if _, err := store.CreateUser(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, descending := range []bool{false, true} {
+		params := models.UserListParams{Limit: 3, SortBy: models.UserSortUsername, Descending: descending}
+		seen := map[int32]bool{}
+		var previous *database.User
+
+		for {
+			users, err := store.ListUsers(ctx, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range *users {
+				user := &(*users)[i]
+				if seen[user.UserID] {
+					t.Fatalf("user %v was listed twice", user.UserID)
+				}
+				seen[user.UserID] = true
+
+				if previous != nil && previous.Username != user.Username && (previous.Username < user.Username) == descending {
+					t.Fatalf("%v is listed after %v", user.Username, previous.Username)
+				}
+				previous = user
+			}
+			if len(*users) < int(params.Limit) {
+				break
+			}
+
+			cursorString, err := EncodeUserCursor(params, previous)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if params.After, err = DecodeUserCursor(params, cursorString); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(seen) != 7 {
+			t.Fatalf("listed %v users, want 7", len(seen))
+		}
+	}
+}
@@ -23,3 +23,11 @@ func StringDateToTimeObject(date string) (time.Time, error) {
 	}
 	return t, nil
 }
+
+// Takes an RFC 3339 timestamp or a date accepted by StringDateToTimeObject and converts it to time.Time in UTC
+func StringTimestampToTimeObject(timestamp string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, timestamp); err == nil {
+		return t.UTC(), nil
+	}
+	return StringDateToTimeObject(timestamp)
+}
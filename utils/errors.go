@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Errors returned by Storage implementations, independent of the database driver
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrEmailTaken      = errors.New("the email is already registered")
+	ErrSessionNotFound = errors.New("session not found")
+
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	// The refresh token was already exchanged, which means it has been replayed
+	ErrRefreshTokenReused = errors.New("refresh token already used")
+
+	// Unknown, expired, already consumed or issued for a different purpose
+	ErrVerificationTokenInvalid = errors.New("invalid or expired verification token")
+
+	ErrClientNotFound  = errors.New("oauth client not found")
+	ErrClientIDTaken   = errors.New("the client id is already registered")
+	ErrAuthCodeInvalid = errors.New("invalid or expired authorization code")
+
+	ErrServiceClientNotFound = errors.New("service client not found")
+
+	ErrHMACKeyNotFound = errors.New("signing key not found")
+	ErrHMACKeyTaken    = errors.New("a signing key with this kid already exists")
+
+	// Unknown, expired or, when looked up by its user code, already decided
+	ErrDeviceCodeNotFound = errors.New("the code is not valid or has expired")
+	ErrUserCodeTaken      = errors.New("the user code is already in use")
+
+	// Unknown, deleted or expired
+	ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+)
+
+const (
+	pqForeignKeyViolation = "23503"
+	pqUniqueViolation     = "23505"
+)
+
+// Constraints whose violation has a meaning of its own
+var constraintErrors = map[string]error{
+	"users_email_key":       ErrEmailTaken,
+	"users_email_lower_key": ErrEmailTaken,
+	"auth_user_id_fkey":     ErrUserNotFound,
+
+	"refresh_tokens_auth_id_fkey":              ErrSessionNotFound,
+	"verification_tokens_user_id_fkey":         ErrUserNotFound,
+	"oauth_clients_pkey":                       ErrClientIDTaken,
+	"auth_client_id_fkey":                      ErrClientNotFound,
+	"oauth_authorization_codes_client_id_fkey": ErrClientNotFound,
+	"oauth_authorization_codes_user_id_fkey":   ErrUserNotFound,
+	"personal_access_tokens_user_id_fkey":      ErrUserNotFound,
+	"service_clients_pkey":                     ErrClientIDTaken,
+	"device_codes_user_code_key":               ErrUserCodeTaken,
+	"device_codes_user_id_fkey":                ErrUserNotFound,
+	"jwt_hmac_keys_pkey":                       ErrHMACKeyTaken,
+}
+
+// Maps database/sql and lib/pq errors to the storage errors above. notFound replaces sql.ErrNoRows.
+func translateError(err error, notFound error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return notFound
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && (pqErr.Code == pqUniqueViolation || pqErr.Code == pqForeignKeyViolation) {
+		if mapped, ok := constraintErrors[pqErr.Constraint]; ok {
+			return mapped
+		}
+	}
+
+	return err
+}
+
+// Turns the row count of an UPDATE or DELETE into notFound when nothing matched
+func rowsAffectedError(rows int64, err error, notFound error) error {
+	if err != nil {
+		return translateError(err, notFound)
+	}
+	if rows == 0 {
+		return notFound
+	}
+	return nil
+}
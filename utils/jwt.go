@@ -1,10 +1,13 @@
 package utils
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -12,80 +15,188 @@ import (
 	"github.com/yuanzix/userAuth/models"
 )
 
-func CreateToken(auth database.Auth) (string, error) {
+// Signs an access token for the user's session that stops being accepted after ttl. Sessions
+// granted to an OAuth client are also meant for the audience the client was registered with.
+func CreateToken(keys *KeyRing, policy TokenPolicy, auth database.Auth, user database.User, clientAudience []string, ttl time.Duration) (string, error) {
+	claims := registeredClaims(policy, UserSubject(user.UserID), clientAudience, ttl)
+	claims["user_id"] = auth.UserID
+	claims["auth_uuid"] = auth.AuthUuid
+	claims["email_verified"] = user.Verified
+
+	if policy.IncludeUsername {
+		claims["username"] = user.Username
+	}
+	if policy.IncludeRole && user.Role.Valid {
+		claims["role"] = user.Role.String
+	}
+
+	if auth.ClientID.Valid {
+		claims["client_id"] = auth.ClientID.String
+		claims["scope"] = auth.Scope
+	}
+
+	return keys.SignToken(claims)
+}
+
+// Signs an access token for a service client acting as itself. The client is the subject,
+// and the principal claim keeps the token from being mistaken for a user's.
+func CreateClientToken(keys *KeyRing, policy TokenPolicy, clientID string, scope string, clientAudience []string, ttl time.Duration) (string, error) {
+	claims := registeredClaims(policy, clientID, clientAudience, ttl)
+	claims["principal"] = string(models.PrincipalClient)
+	claims["client_id"] = clientID
+	claims["scope"] = scope
+
+	return keys.SignToken(claims)
+}
+
+// The claims of RFC 7519 section 4.1 that every access token carries. The jti tells
+// tokens apart for downstream services that log or deny-list them.
+func registeredClaims(policy TokenPolicy, subject string, clientAudience []string, ttl time.Duration) jwt.MapClaims {
+	now := time.Now()
 	claims := jwt.MapClaims{
-		"email":     auth.UserEmail,
-		"auth_uuid": auth.AuthUuid,
-		"iss":       "userAuth",
+		"sub": subject,
+		"jti": uuid.NewString(),
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"exp": now.Add(ttl).Unix(),
+	}
+
+	if policy.Issuer != "" {
+		claims["iss"] = policy.Issuer
+	}
+	if audience := policy.audience(clientAudience); len(audience) > 0 {
+		claims["aud"] = audience
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return claims
+}
+
+// The stable identifier of a user in the sub claim of the tokens we issue
+func UserSubject(userID int32) string {
+	return strconv.Itoa(int(userID))
+}
 
-	secretKey, err := ReadJWTSecret()
+// Signs an OpenID Connect ID token telling clientID who the user is
+func CreateIDToken(keys *KeyRing, issuer string, clientID string, nonce string, info models.UserInfo, ttl time.Duration) (string, error) {
+	// The user's claims are flattened into the token next to the registered ones
+	encoded, err := json.Marshal(info)
 	if err != nil {
 		return "", err
 	}
 
-	tokenString, err := token.SignedString(secretKey)
-	if err != nil {
+	claims := jwt.MapClaims{}
+	if err := json.Unmarshal(encoded, &claims); err != nil {
 		return "", err
 	}
 
-	return tokenString, nil
+	now := time.Now()
+	claims["iss"] = issuer
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	return keys.SignIDToken(claims)
 }
 
-func ValidateToken(r *http.Request, checkExists func(models.AuthDetails) (bool, error)) (string, error) {
-	token, err := VerifyToken(r)
+// Verifies the request's token and checks that its principal is still around. For users
+// touchSession is expected to record the session as used and report whether it was found
+// alive under the policy; for service clients clientExists reports whether the client is
+// still registered.
+func ValidateToken(r *http.Request, keys *KeyRing, tokens TokenPolicy, policy SessionPolicy, touchSession func(context.Context, models.AuthDetails, SessionPolicy) (bool, error), clientExists func(context.Context, string) (bool, error)) (*models.AuthDetails, error) {
+	token, err := VerifyToken(r, keys, tokens)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	auth, err := ExtractTokenAuth(r)
+	auth, err := tokenAuth(token)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	exists, err := checkExists(*auth)
+	var exists bool
+	switch auth.Principal {
+	case models.PrincipalClient:
+		exists, err = clientExists(r.Context(), auth.ClientID)
+	default:
+		exists, err = touchSession(r.Context(), *auth, policy)
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	if !exists || !token.Valid {
-		return "", errors.New("invalid token")
+		return nil, errors.New("invalid token")
 	}
 
-	return auth.UserEmail, nil
+	return auth, nil
 }
 
-func VerifyToken(r *http.Request) (*jwt.Token, error) {
-	tokenString := ExtractTokenString(r)
-	if tokenString == "" {
-		return nil, errors.New("token not provided")
+// Verifies the request's token, which must have been issued by us for our audience
+func VerifyToken(r *http.Request, keys *KeyRing, policy TokenPolicy) (*jwt.Token, error) {
+	return parseToken(ExtractTokenString(r), keys, policy)
+}
+
+func ExtractTokenAuth(r *http.Request, keys *KeyRing, policy TokenPolicy) (*models.AuthDetails, error) {
+	token, err := VerifyToken(r, keys, policy)
+	if err != nil {
+		return nil, err
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			err := fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			return nil, err
-		}
-		return ReadJWTSecret()
-	})
+	return tokenAuth(token)
+}
 
+// Verifies an access token that was not sent as the request's own credentials, such as
+// one a resource server asks about, and reads the session it belongs to
+func ParseTokenAuth(tokenString string, keys *KeyRing, policy TokenPolicy) (*models.AuthDetails, error) {
+	token, err := parseToken(tokenString, keys, policy)
 	if err != nil {
 		return nil, err
 	}
 
-	return token, nil
+	return tokenAuth(token)
 }
 
-func ExtractTokenAuth(r *http.Request) (*models.AuthDetails, error) {
-	token, err := VerifyToken(r)
+func parseToken(tokenString string, keys *KeyRing, policy TokenPolicy) (*jwt.Token, error) {
+	if tokenString == "" {
+		return nil, errors.New("token not provided")
+	}
+
+	token, err := jwt.Parse(tokenString, keys.verificationKey, policy.parserOptions()...)
+
 	if err != nil {
 		return nil, err
 	}
 
+	return token, nil
+}
+
+func tokenAuth(token *jwt.Token) (*models.AuthDetails, error) {
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if ok && token.Valid {
+		// Required by the parser, so always present
+		expiresAt, err := claims.GetExpirationTime()
+		if err != nil {
+			return nil, err
+		}
+
+		if principal, _ := claims["principal"].(string); principal == string(models.PrincipalClient) {
+			clientID, ok := claims["client_id"].(string)
+			if !ok || clientID == "" {
+				return nil, errors.New("invalid client_id claim")
+			}
+			scope, _ := claims["scope"].(string)
+
+			return &models.AuthDetails{
+				Principal: models.PrincipalClient,
+				ClientID:  clientID,
+				Scope:     scope,
+				ExpiresAt: expiresAt.Time,
+			}, nil
+		}
+
 		authUUIDStr, ok := claims["auth_uuid"].(string)
 		if !ok {
 			return nil, errors.New("invalid auth_uuid claim")
@@ -96,32 +207,43 @@ func ExtractTokenAuth(r *http.Request) (*models.AuthDetails, error) {
 			return nil, errors.New("failed to parse auth_uuid")
 		}
 
-		userEmail, ok := claims["email"].(string)
+		// JSON numbers are decoded as float64
+		userID, ok := claims["user_id"].(float64)
 		if !ok {
-			return nil, errors.New("invalid email claim")
+			return nil, errors.New("invalid user_id claim")
 		}
 
+		// Only present on tokens granted to an OAuth client
+		clientID, _ := claims["client_id"].(string)
+		scope, _ := claims["scope"].(string)
+
 		return &models.AuthDetails{
+			Principal: models.PrincipalUser,
+			UserID:    int32(userID),
 			AuthUUID:  authUuid,
-			UserEmail: userEmail,
+			ClientID:  clientID,
+			Scope:     scope,
+			ExpiresAt: expiresAt.Time,
 		}, nil
 	}
 
 	return nil, errors.New("invalid token claims")
 }
 
+// Takes the token from the Authorization header, or from the session cookie of a browser
+// client. Tokens in the query string are not accepted, as they end up in logs and history.
 func ExtractTokenString(r *http.Request) string {
-	token := r.URL.Query().Get("token")
-	if token != "" {
-		return token
-	}
-
 	tokenString := r.Header.Get("Authorization")
 	if tokenString != "" {
 		strArr := strings.Split(tokenString, " ")
 		if len(strArr) == 2 {
 			return strArr[1]
 		}
+		return ""
+	}
+
+	if cookie, err := r.Cookie(AccessTokenCookie); err == nil {
+		return cookie.Value
 	}
 
 	return ""
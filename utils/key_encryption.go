@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+)
+
+// KeyEncryptionKey encrypts the HMAC secrets kept in the database with AES-256-GCM, so
+// that a copy of the database alone is not enough to sign tokens. The kid is bound to
+// each secret, which keeps a secret from being passed off as another key's.
+type KeyEncryptionKey struct {
+	aead cipher.AEAD
+}
+
+// Reads JWT_KEY_ENCRYPTION_KEY, 32 random bytes encoded in base64, e.g. from
+// openssl rand -base64 32. Returns nil when it is not set.
+func ReadKeyEncryptionKey() (*KeyEncryptionKey, error) {
+	values, err := readEnvValues("JWT_KEY_ENCRYPTION_KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := values["JWT_KEY_ENCRYPTION_KEY"]
+	if !ok {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY must be base64")
+	}
+	return NewKeyEncryptionKey(key)
+}
+
+func NewKeyEncryptionKey(key []byte) (*KeyEncryptionKey, error) {
+	if len(key) != 32 {
+		return nil, errors.New("JWT_KEY_ENCRYPTION_KEY must be 32 bytes")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyEncryptionKey{aead: aead}, nil
+}
+
+// Encrypts the secret of the key named kid, prefixed with the random nonce
+func (k *KeyEncryptionKey) Seal(kid string, secret []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return k.aead.Seal(nonce, nonce, secret, []byte(kid)), nil
+}
+
+// Decrypts what Seal returned for the key named kid
+func (k *KeyEncryptionKey) Open(kid string, sealed []byte) ([]byte, error) {
+	if len(sealed) < k.aead.NonceSize() {
+		return nil, errors.New("the encrypted secret is too short")
+	}
+	nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+	return k.aead.Open(nil, nonce, ciphertext, []byte(kid))
+}
@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+)
+
+func newTestKeyEncryptionKey(t *testing.T) *KeyEncryptionKey {
+	t.Helper()
+
+	kek, err := NewKeyEncryptionKey(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kek
+}
+
+func TestKeyEncryptionKeyRoundTrip(t *testing.T) {
+	kek := newTestKeyEncryptionKey(t)
+	secret := []byte("an HMAC secret")
+
+	sealed, err := kek.Seal("hs-1", secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, secret) {
+		t.Fatal("the secret is stored in the clear")
+	}
+
+	opened, err := kek.Open("hs-1", sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(opened, secret) {
+		t.Fatalf("got %q, want %q", opened, secret)
+	}
+
+	// Each secret is bound to its kid
+	if _, err := kek.Open("hs-2", sealed); err == nil {
+		t.Fatal("the secret was opened under another kid")
+	}
+
+	other, err := NewKeyEncryptionKey(bytes.Repeat([]byte{8}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.Open("hs-1", sealed); err == nil {
+		t.Fatal("the secret was opened with another key")
+	}
+
+	if _, err := kek.Open("hs-1", sealed[:4]); err == nil {
+		t.Fatal("a truncated secret was opened")
+	}
+}
+
+func TestReadKeyEncryptionKey(t *testing.T) {
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", "")
+	if kek, err := ReadKeyEncryptionKey(); err != nil || kek != nil {
+		t.Fatalf("got %v, %v without JWT_KEY_ENCRYPTION_KEY", kek, err)
+	}
+
+	t.Setenv("JWT_KEY_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	if kek, err := ReadKeyEncryptionKey(); err != nil || kek == nil {
+		t.Fatalf("got %v, %v", kek, err)
+	}
+
+	for _, value := range []string{"not base64!", base64.StdEncoding.EncodeToString([]byte("too short"))} {
+		t.Setenv("JWT_KEY_ENCRYPTION_KEY", value)
+		if _, err := ReadKeyEncryptionKey(); err == nil {
+			t.Fatalf("JWT_KEY_ENCRYPTION_KEY=%v was accepted", value)
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yuanzix/userAuth/internal/database"
+	"github.com/yuanzix/userAuth/models"
+)
+
+// KeyRing holds the keys tokens are signed and verified with. Asymmetric keys are
+// identified by the kid header, which is their RFC 7638 thumbprint. Without a signing
+// key, tokens are signed with the active HMAC key from the database, named by its kid,
+// or failing that with the HMAC secret, which is also what tokens without a kid are
+// checked against.
+type KeyRing struct {
+	signing    *jwtKey
+	keys       map[string]*jwtKey
+	hmacSecret []byte
+	// Public keys in the order they were configured, the signing key first
+	published []models.JWK
+	// Decrypts the HMAC keys from the database, nil when JWT_KEY_ENCRYPTION_KEY is not set
+	kek *KeyEncryptionKey
+
+	// The HMAC keys are reloaded while the server runs, the rest is fixed at startup
+	mu       sync.RWMutex
+	hmacKeys map[string][]byte
+	// The kid of the HMAC key tokens are signed with, empty when none has been promoted
+	hmacSigningKid string
+}
+
+type jwtKey struct {
+	kid    string
+	method jwt.SigningMethod
+	// Only set for the signing key
+	private crypto.Signer
+	public  crypto.PublicKey
+	jwk     models.JWK
+}
+
+// Builds the key ring from JWT_SIGNING_KEY_FILE, a PEM private key, JWT_VERIFICATION_KEY_FILES,
+// a comma-separated list of PEM public or private keys that are still accepted, and JWT_SECRET.
+// The HMAC keys kept in the database are added by ReloadHMACKeys, after which CanSign tells
+// whether any key to sign with has been configured.
+func ReadKeyRing() (*KeyRing, error) {
+	values, err := readEnvValues("JWT_SECRET", "JWT_SIGNING_KEY_FILE", "JWT_VERIFICATION_KEY_FILES")
+	if err != nil {
+		return nil, err
+	}
+	kek, err := ReadKeyEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &KeyRing{
+		keys:       map[string]*jwtKey{},
+		hmacSecret: []byte(values["JWT_SECRET"]),
+		kek:        kek,
+		hmacKeys:   map[string][]byte{},
+	}
+
+	if path, ok := values["JWT_SIGNING_KEY_FILE"]; ok {
+		key, err := readJWTKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if key.private == nil {
+			return nil, fmt.Errorf("JWT_SIGNING_KEY_FILE %v does not contain a private key", path)
+		}
+		keys.signing = key
+		keys.keys[key.kid] = key
+		keys.published = append(keys.published, key.jwk)
+	}
+
+	if paths, ok := values["JWT_VERIFICATION_KEY_FILES"]; ok {
+		for _, path := range strings.Split(paths, ",") {
+			path = strings.TrimSpace(path)
+			if path == "" {
+				continue
+			}
+
+			key, err := readJWTKeyFile(path)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := keys.keys[key.kid]; !ok {
+				key.private = nil
+				keys.keys[key.kid] = key
+				keys.published = append(keys.published, key.jwk)
+			}
+		}
+	}
+
+	return keys, nil
+}
+
+// Replaces the HMAC keys with those in the store. The key promoted most recently becomes
+// the one tokens are signed with, unless an asymmetric signing key is configured.
+func (k *KeyRing) ReloadHMACKeys(ctx context.Context, store Storage) error {
+	stored, err := store.ListHMACKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	hmacKeys := make(map[string][]byte, len(*stored))
+	for _, key := range *stored {
+		if k.kek == nil {
+			return errors.New("the HMAC keys in the database are encrypted, set JWT_KEY_ENCRYPTION_KEY to use them")
+		}
+		secret, err := k.kek.Open(key.Kid, key.Secret)
+		if err != nil {
+			return fmt.Errorf("could not decrypt HMAC key %v, is JWT_KEY_ENCRYPTION_KEY the one it was added with: %w", key.Kid, err)
+		}
+		hmacKeys[key.Kid] = secret
+	}
+	signing := ActiveHMACKey(*stored)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.hmacKeys = hmacKeys
+	k.hmacSigningKid = ""
+	if signing != nil {
+		k.hmacSigningKid = signing.Kid
+	}
+	return nil
+}
+
+// The key promoted most recently, nil if none has been promoted yet
+func ActiveHMACKey(keys []database.JwtHmacKey) *database.JwtHmacKey {
+	var active *database.JwtHmacKey
+	for i, key := range keys {
+		if key.PromotedAt.Valid && (active == nil || key.PromotedAt.Time.After(active.PromotedAt.Time)) {
+			active = &keys[i]
+		}
+	}
+	return active
+}
+
+// When the key last signed tokens: now for the signing key, and when the next key was
+// promoted for one that has been replaced. The second result is false if it never signed.
+func HMACKeyLastSigned(keys []database.JwtHmacKey, kid string, now time.Time) (time.Time, bool) {
+	var promotedAt time.Time
+	for _, key := range keys {
+		if key.Kid == kid && key.PromotedAt.Valid {
+			promotedAt = key.PromotedAt.Time
+		}
+	}
+	if promotedAt.IsZero() {
+		return time.Time{}, false
+	}
+
+	lastSigned := now
+	for _, key := range keys {
+		if key.PromotedAt.Valid && key.PromotedAt.Time.After(promotedAt) && key.PromotedAt.Time.Before(lastSigned) {
+			lastSigned = key.PromotedAt.Time
+		}
+	}
+	return lastSigned, true
+}
+
+// Reports whether there is a key to sign tokens with
+func (k *KeyRing) CanSign() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	return k.signing != nil || k.hmacSigningKid != "" || len(k.hmacSecret) > 0
+}
+
+// The kid of the HMAC key tokens are signed with, empty if they are signed some other way
+func (k *KeyRing) HMACSigningKid() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if k.signing != nil {
+		return ""
+	}
+	return k.hmacSigningKid
+}
+
+// Signs the claims with the active key
+func (k *KeyRing) SignToken(claims jwt.Claims) (string, error) {
+	if k.signing != nil {
+		token := jwt.NewWithClaims(k.signing.method, claims)
+		token.Header["kid"] = k.signing.kid
+		return token.SignedString(k.signing.private)
+	}
+
+	k.mu.RLock()
+	kid, secret := k.hmacSigningKid, k.hmacKeys[k.hmacSigningKid]
+	k.mu.RUnlock()
+
+	if kid == "" {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(secret)
+}
+
+// Reports whether ID tokens can be signed. They need an asymmetric key, as relying
+// parties can only check them against the published keys.
+func (k *KeyRing) CanSignIDTokens() bool {
+	return k.signing != nil
+}
+
+// Signs the claims of an ID token with the asymmetric signing key
+func (k *KeyRing) SignIDToken(claims jwt.Claims) (string, error) {
+	if k.signing == nil {
+		return "", errors.New("ID tokens need an asymmetric JWT_SIGNING_KEY_FILE")
+	}
+	return k.SignToken(claims)
+}
+
+// The algorithm tokens are currently signed with
+func (k *KeyRing) SigningAlg() string {
+	if k.signing == nil {
+		return jwt.SigningMethodHS256.Alg()
+	}
+	return k.signing.method.Alg()
+}
+
+// Looks up the key a token claims to be signed with, for use as a jwt.Keyfunc.
+// The algorithm is pinned to the key so a token cannot choose how it is checked.
+func (k *KeyRing) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && len(k.hmacSecret) > 0 {
+			return k.hmacSecret, nil
+		}
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	key, ok := k.keys[kid]
+	if !ok {
+		k.mu.RLock()
+		secret, ok := k.hmacKeys[kid]
+		k.mu.RUnlock()
+
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		if token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return secret, nil
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.public, nil
+}
+
+// Generates a new HMAC key and the kid it is to be known by
+func GenerateHMACKey() (kid string, secret []byte, err error) {
+	secret = make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+
+	return "hs-" + base64.RawURLEncoding.EncodeToString(id), secret, nil
+}
+
+// The public half of every asymmetric key, for publishing as a JWK Set
+func (k *KeyRing) JWKS() models.JWKSResponse {
+	return models.JWKSResponse{Keys: append([]models.JWK{}, k.published...)}
+}
+
+func readJWTKeyFile(path string) (*jwtKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("%v is not a PEM file", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%v: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+
+	key, err := newJWTKey(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return key, nil
+}
+
+func newJWTKey(parsed any) (*jwtKey, error) {
+	key := &jwtKey{}
+
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.private = signer
+		parsed = signer.Public()
+	}
+	key.public = parsed
+
+	switch public := parsed.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		key.method = jwt.SigningMethodRS256
+		key.jwk = models.JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}
+
+	case *ecdsa.PublicKey:
+		var crv string
+		switch public.Curve {
+		case elliptic.P256():
+			key.method, crv = jwt.SigningMethodES256, "P-256"
+		case elliptic.P384():
+			key.method, crv = jwt.SigningMethodES384, "P-384"
+		case elliptic.P521():
+			key.method, crv = jwt.SigningMethodES512, "P-521"
+		default:
+			return nil, errors.New("unsupported elliptic curve")
+		}
+		size := (public.Curve.Params().BitSize + 7) / 8
+		key.jwk = models.JWK{
+			Kty: "EC",
+			Crv: crv,
+			X:   base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, size))),
+			Y:   base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, size))),
+		}
+
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+		key.jwk = models.JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(public),
+		}
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	key.kid = jwkThumbprint(key.jwk)
+	key.jwk.Kid = key.kid
+	key.jwk.Alg = key.method.Alg()
+	key.jwk.Use = "sig"
+
+	return key, nil
+}
+
+// RFC 7638: the hash of the key's required members in lexicographic order, without whitespace
+func jwkThumbprint(jwk models.JWK) string {
+	var members string
+	switch jwk.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":"%v","kty":"RSA","n":"%v"}`, jwk.E, jwk.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":"%v","kty":"EC","x":"%v","y":"%v"}`, jwk.Crv, jwk.X, jwk.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":"%v","kty":"OKP","x":"%v"}`, jwk.Crv, jwk.X)
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
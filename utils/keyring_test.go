@@ -0,0 +1,278 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/yuanzix/userAuth/internal/database"
+	"github.com/yuanzix/userAuth/models"
+)
+
+// A key ring signing with private, that also accepts tokens without a kid signed with secret
+func newTestKeyRing(t *testing.T, private crypto.Signer, secret string) *KeyRing {
+	t.Helper()
+
+	key, err := newJWTKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &KeyRing{
+		signing:    key,
+		keys:       map[string]*jwtKey{key.kid: key},
+		hmacSecret: []byte(secret),
+		hmacKeys:   map[string][]byte{},
+		published:  []models.JWK{key.jwk},
+	}
+}
+
+func testClaims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{"sub": "user:1", "iat": now.Unix(), "exp": now.Add(time.Minute).Unix()}
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, testClaims())
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	tokenString, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokenString
+}
+
+func TestKeyRingVerifiesItsOwnTokens(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := newTestKeyRing(t, private, "secret")
+
+	tokenString, err := keys.SignToken(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := parseToken(tokenString, keys, TokenPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != keys.signing.kid || token.Method.Alg() != "EdDSA" {
+		t.Fatalf("got header %v", token.Header)
+	}
+
+	// Tokens from before the key ring, signed with JWT_SECRET and without a kid, are still accepted
+	if _, err := parseToken(signTestToken(t, jwt.SigningMethodHS256, "", []byte("secret")), keys, TokenPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKeyRingPinsAlgorithms(t *testing.T) {
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := newTestKeyRing(t, p256, "secret")
+	kid := keys.signing.kid
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&p256.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		// The published public key used as an HMAC secret, the classic algorithm confusion attack
+		"HS256 with the kid of an EC key":   signTestToken(t, jwt.SigningMethodHS256, kid, publicDER),
+		"ES384 with the kid of a P-256 key": signTestToken(t, jwt.SigningMethodES384, kid, p384),
+		"EC key without a kid":              signTestToken(t, jwt.SigningMethodES256, "", p256),
+		"unknown kid":                       signTestToken(t, jwt.SigningMethodES256, "unknown", p256),
+		"HS256 with the wrong secret":       signTestToken(t, jwt.SigningMethodHS256, "", []byte("guess")),
+		"alg none":                          signTestToken(t, jwt.SigningMethodNone, kid, jwt.UnsafeAllowNoneSignatureType),
+	}
+
+	for name, tokenString := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseToken(tokenString, keys, TokenPolicy{}); err == nil {
+				t.Fatal("the token was accepted")
+			}
+		})
+	}
+}
+
+func TestKeyRingWithoutSecretRefusesTokensWithoutKid(t *testing.T) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := newTestKeyRing(t, private, "")
+
+	// An empty JWT_SECRET must not become an empty HMAC key anyone can sign with
+	if _, err := parseToken(signTestToken(t, jwt.SigningMethodHS256, "", []byte("")), keys, TokenPolicy{}); err == nil {
+		t.Fatal("the token was accepted")
+	}
+}
+
+// The example from RFC 7638 section 3.1
+func TestJWKThumbprint(t *testing.T) {
+	jwk := models.JWK{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	if got := jwkThumbprint(jwk); got != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Fatalf("got %v", got)
+	}
+}
+
+// Adds an HMAC key to the store the way the keys command does
+func addTestHMACKey(t *testing.T, store Storage, kek *KeyEncryptionKey) (kid string, secret []byte) {
+	t.Helper()
+
+	kid, secret, err := GenerateHMACKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := kek.Seal(kid, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateHMACKey(context.Background(), kid, sealed); err != nil {
+		t.Fatal(err)
+	}
+	return kid, secret
+}
+
+func TestKeyRingStoredHMACKeys(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	kek := newTestKeyEncryptionKey(t)
+	keys := &KeyRing{keys: map[string]*jwtKey{}, hmacSecret: []byte("secret"), hmacKeys: map[string][]byte{}, kek: kek}
+
+	oldKid, oldSecret := addTestHMACKey(t, store, kek)
+	newKid, newSecret := addTestHMACKey(t, store, kek)
+	if err := store.PromoteHMACKey(ctx, oldKid); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.ReloadHMACKeys(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if keys.HMACSigningKid() != oldKid {
+		t.Fatalf("signing with %q, want %q", keys.HMACSigningKid(), oldKid)
+	}
+
+	// A key is accepted before it is promoted, so every server knows it before any signs with it
+	if _, err := parseToken(signTestToken(t, jwt.SigningMethodHS256, newKid, newSecret), keys, TokenPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.PromoteHMACKey(ctx, newKid); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.ReloadHMACKeys(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	tokenString, err := keys.SignToken(testClaims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := parseToken(tokenString, keys, TokenPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Header["kid"] != newKid {
+		t.Fatalf("signed with %v, want %v", token.Header["kid"], newKid)
+	}
+
+	tests := map[string]string{
+		"HS512 with the kid of an HS256 key": signTestToken(t, jwt.SigningMethodHS512, oldKid, oldSecret),
+		"another key's secret":               signTestToken(t, jwt.SigningMethodHS256, oldKid, newSecret),
+	}
+	for name, tokenString := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseToken(tokenString, keys, TokenPolicy{}); err == nil {
+				t.Fatal("the token was accepted")
+			}
+		})
+	}
+
+	// Tokens signed with a retired key are refused once the servers reload
+	oldToken := signTestToken(t, jwt.SigningMethodHS256, oldKid, oldSecret)
+	if _, err := parseToken(oldToken, keys, TokenPolicy{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RetireHMACKey(ctx, oldKid); err != nil {
+		t.Fatal(err)
+	}
+	if err := keys.ReloadHMACKeys(ctx, store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseToken(oldToken, keys, TokenPolicy{}); err == nil {
+		t.Fatal("a token signed with a retired key was accepted")
+	}
+}
+
+func TestReloadHMACKeysNeedsKeyEncryptionKey(t *testing.T) {
+	store := NewMemoryStore()
+	addTestHMACKey(t, store, newTestKeyEncryptionKey(t))
+
+	keys := &KeyRing{keys: map[string]*jwtKey{}, hmacKeys: map[string][]byte{}}
+	if err := keys.ReloadHMACKeys(context.Background(), store); err == nil {
+		t.Fatal("the keys were loaded without JWT_KEY_ENCRYPTION_KEY")
+	}
+
+	other, err := NewKeyEncryptionKey(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys.kek = other
+	if err := keys.ReloadHMACKeys(context.Background(), store); err == nil {
+		t.Fatal("the keys were loaded with the wrong JWT_KEY_ENCRYPTION_KEY")
+	}
+}
+
+func TestHMACKeyLastSigned(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	promoted := func(ago time.Duration) sql.NullTime {
+		return sql.NullTime{Time: now.Add(-ago), Valid: true}
+	}
+	keys := []database.JwtHmacKey{
+		{Kid: "first", PromotedAt: promoted(3 * time.Hour)},
+		{Kid: "second", PromotedAt: promoted(time.Hour)},
+		{Kid: "third", PromotedAt: promoted(10 * time.Minute)},
+		{Kid: "unpromoted"},
+	}
+
+	tests := []struct {
+		kid    string
+		want   time.Time
+		signed bool
+	}{
+		{"first", now.Add(-time.Hour), true},
+		{"second", now.Add(-10 * time.Minute), true},
+		{"third", now, true},
+		{"unpromoted", time.Time{}, false},
+		{"unknown", time.Time{}, false},
+	}
+
+	for _, tt := range tests {
+		got, signed := HMACKeyLastSigned(keys, tt.kid, now)
+		if signed != tt.signed || !got.Equal(tt.want) {
+			t.Errorf("HMACKeyLastSigned(%v) = %v, %v, want %v, %v", tt.kid, got, signed, tt.want, tt.signed)
+		}
+	}
+}
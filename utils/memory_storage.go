@@ -0,0 +1,1224 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yuanzix/userAuth/internal/database"
+	"github.com/yuanzix/userAuth/models"
+)
+
+// MemoryStore is an in-memory Storage meant for tests and local development.
+// It mirrors the behaviour of PostgresStore, including the errors it returns.
+type MemoryStore struct {
+	// txMu serialises transactions; mu guards the data itself
+	txMu sync.Mutex
+	mu   sync.RWMutex
+	// Keyed by lowercased email, matching the case-insensitive unique index in Postgres
+	users         map[string]*database.User
+	auths         []database.Auth
+	refreshTokens []database.RefreshToken
+	// Verification tokens reference the user with ON DELETE CASCADE
+	verificationTokens []database.VerificationToken
+	oauthClients       map[string]*database.OauthClient
+	// Keyed by code hash
+	authCodes            map[string]database.OauthAuthorizationCode
+	personalAccessTokens []database.PersonalAccessToken
+	serviceClients       map[string]*database.ServiceClient
+	deviceCodes          map[string]database.DeviceCode
+	hmacKeys             []database.JwtHmacKey
+
+	nextUserID                int32
+	nextAuthID                int32
+	nextRefreshTokenID        int32
+	nextVerificationTokenID   int32
+	nextPersonalAccessTokenID int32
+}
+
+var _ Storage = (*MemoryStore)(nil)
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:          map[string]*database.User{},
+		oauthClients:   map[string]*database.OauthClient{},
+		authCodes:      map[string]database.OauthAuthorizationCode{},
+		serviceClients: map[string]*database.ServiceClient{},
+		deviceCodes:    map[string]database.DeviceCode{},
+	}
+}
+
+func (s *MemoryStore) CreateUser(ctx context.Context, u *models.User) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[strings.ToLower(u.Email)]; ok {
+		return &database.User{}, ErrEmailTaken
+	}
+
+	s.nextUserID++
+	now := time.Now().UTC()
+	user := database.User{
+		UserID:         s.nextUserID,
+		Email:          u.Email,
+		Username:       u.Username,
+		HashedPassword: u.HashedPassword,
+		FirstName:      u.FirstName,
+		LastName:       u.LastName,
+		DateOfBirth:    u.DateOfBirth,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	s.users[strings.ToLower(u.Email)] = &user
+
+	created := user
+	return &created, nil
+}
+
+func (s *MemoryStore) IsUserVerified(ctx context.Context, email string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[strings.ToLower(email)]
+	if !ok {
+		return false, ErrUserNotFound
+	}
+	return user.Verified, nil
+}
+
+func (s *MemoryStore) VerifyUser(ctx context.Context, userID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.userByID(userID)
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Verified = true
+	return nil
+}
+
+func (s *MemoryStore) SetUserMaxSessions(ctx context.Context, userID int32, maxSessions sql.NullInt32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.userByID(userID)
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.MaxSessions = maxSessions
+	return nil
+}
+
+func (s *MemoryStore) SetUserRole(ctx context.Context, userID int32, role sql.NullString) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.userByID(userID)
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Role = role
+	return nil
+}
+
+func (s *MemoryStore) DeleteUser(ctx context.Context, userID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.userByID(userID)
+	if !ok {
+		return ErrUserNotFound
+	}
+	delete(s.users, strings.ToLower(user.Email))
+
+	keptTokens := []database.VerificationToken{}
+	for _, verificationToken := range s.verificationTokens {
+		if verificationToken.UserID != userID {
+			keptTokens = append(keptTokens, verificationToken)
+		}
+	}
+	s.verificationTokens = keptTokens
+
+	keptAccessTokens := []database.PersonalAccessToken{}
+	for _, accessToken := range s.personalAccessTokens {
+		if accessToken.UserID != userID {
+			keptAccessTokens = append(keptAccessTokens, accessToken)
+		}
+	}
+	s.personalAccessTokens = keptAccessTokens
+
+	for codeHash, code := range s.authCodes {
+		if code.UserID == userID {
+			delete(s.authCodes, codeHash)
+		}
+	}
+
+	for codeHash, code := range s.deviceCodes {
+		if code.UserID.Valid && code.UserID.Int32 == userID {
+			delete(s.deviceCodes, codeHash)
+		}
+	}
+
+	// Sessions reference the user with ON DELETE CASCADE
+	s.deleteAuthWhere(func(a database.Auth) bool {
+		return a.UserID == userID
+	})
+	return nil
+}
+
+func (s *MemoryStore) UpdateUser(ctx context.Context, userID int32, u *models.User) (*database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.userByID(userID)
+	if !ok {
+		return &database.User{}, ErrUserNotFound
+	}
+
+	if u.Username != "" {
+		user.Username = u.Username
+	}
+	if u.FirstName != "" {
+		user.FirstName = u.FirstName
+	}
+	if u.LastName != "" {
+		user.LastName = u.LastName
+	}
+	if !u.DateOfBirth.IsZero() {
+		user.DateOfBirth = u.DateOfBirth
+	}
+	user.UpdatedAt = time.Now().UTC()
+
+	updated := *user
+	return &updated, nil
+}
+
+func (s *MemoryStore) GetUserByEmail(ctx context.Context, email string) (*database.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[strings.ToLower(email)]
+	if !ok {
+		return &database.User{}, ErrUserNotFound
+	}
+
+	found := *user
+	return &found, nil
+}
+
+func (s *MemoryStore) GetUserByID(ctx context.Context, userID int32) (*database.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.userByID(userID)
+	if !ok {
+		return &database.User{}, ErrUserNotFound
+	}
+
+	found := *user
+	return &found, nil
+}
+
+func (s *MemoryStore) ListUsers(ctx context.Context, params models.UserListParams) (*[]database.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// less reports whether a sorts before b in ascending order
+	less := func(a, b *database.User) bool {
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.UserID < b.UserID
+	}
+	if params.SortBy == models.UserSortUsername {
+		less = func(a, b *database.User) bool {
+			if a.Username != b.Username {
+				return a.Username < b.Username
+			}
+			return a.UserID < b.UserID
+		}
+	}
+
+	var after *database.User
+	if params.After != nil {
+		after = &database.User{
+			UserID:    params.After.UserID,
+			CreatedAt: params.After.CreatedAt,
+			Username:  params.After.Username,
+		}
+	}
+
+	users := []database.User{}
+	for _, user := range s.users {
+		if params.Verified != nil && user.Verified != *params.Verified {
+			continue
+		}
+		if params.CreatedAfter != nil && user.CreatedAt.Before(*params.CreatedAfter) {
+			continue
+		}
+		if params.CreatedBefore != nil && !user.CreatedAt.Before(*params.CreatedBefore) {
+			continue
+		}
+		if after != nil {
+			if params.Descending && !less(user, after) {
+				continue
+			}
+			if !params.Descending && !less(after, user) {
+				continue
+			}
+		}
+		users = append(users, *user)
+	}
+
+	sort.Slice(users, func(i, j int) bool {
+		if params.Descending {
+			return less(&users[j], &users[i])
+		}
+		return less(&users[i], &users[j])
+	})
+
+	if int32(len(users)) > params.Limit {
+		users = users[:params.Limit]
+	}
+
+	return &users, nil
+}
+
+func (s *MemoryStore) GetHashedPassword(ctx context.Context, email string) (hashedPassword string, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[strings.ToLower(email)]
+	if !ok {
+		return "", ErrUserNotFound
+	}
+	return user.HashedPassword, nil
+}
+
+func (s *MemoryStore) CreateAuth(ctx context.Context, userID int32, meta models.SessionMetadata) (*database.Auth, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.userByID(userID); !ok {
+		return &database.Auth{}, ErrUserNotFound
+	}
+	if _, ok := s.oauthClients[meta.ClientID]; meta.ClientID != "" && !ok {
+		return &database.Auth{}, ErrClientNotFound
+	}
+
+	s.nextAuthID++
+	now := time.Now().UTC()
+	auth := database.Auth{
+		AuthID:     s.nextAuthID,
+		AuthUuid:   uuid.New(),
+		UserID:     userID,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		IpAddress:  meta.IPAddress,
+		UserAgent:  meta.UserAgent,
+		DeviceName: meta.DeviceName,
+		ClientID:   sql.NullString{String: meta.ClientID, Valid: meta.ClientID != ""},
+		Scope:      meta.Scope,
+	}
+	s.auths = append(s.auths, auth)
+
+	return &auth, nil
+}
+
+func (s *MemoryStore) GetAuth(ctx context.Context, userID int32) (*database.Auth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, auth := range s.auths {
+		if auth.UserID == userID {
+			found := auth
+			return &found, nil
+		}
+	}
+	return &database.Auth{}, ErrSessionNotFound
+}
+
+func (s *MemoryStore) GetAuthByID(ctx context.Context, authID int32) (*database.Auth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, auth := range s.auths {
+		if auth.AuthID == authID {
+			found := auth
+			return &found, nil
+		}
+	}
+	return &database.Auth{}, ErrSessionNotFound
+}
+
+func (s *MemoryStore) GetAuthByUUID(ctx context.Context, details models.AuthDetails) (*database.Auth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, auth := range s.auths {
+		if auth.UserID == details.UserID && auth.AuthUuid == details.AuthUUID {
+			found := auth
+			return &found, nil
+		}
+	}
+	return &database.Auth{}, ErrSessionNotFound
+}
+
+func (s *MemoryStore) ListAuth(ctx context.Context, userID int32) (*[]database.Auth, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	auths := []database.Auth{}
+	for _, auth := range s.auths {
+		if auth.UserID == userID {
+			auths = append(auths, auth)
+		}
+	}
+
+	sort.Slice(auths, func(i, j int) bool {
+		if !auths[i].LastUsedAt.Equal(auths[j].LastUsedAt) {
+			return auths[i].LastUsedAt.After(auths[j].LastUsedAt)
+		}
+		return auths[i].AuthID > auths[j].AuthID
+	})
+
+	return &auths, nil
+}
+
+func (s *MemoryStore) DeleteAuth(ctx context.Context, auth models.AuthDetails) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := s.deleteAuthWhere(func(a database.Auth) bool {
+		return a.UserID == auth.UserID && a.AuthUuid == auth.AuthUUID
+	})
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteAuthByID(ctx context.Context, authID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := s.deleteAuthWhere(func(a database.Auth) bool {
+		return a.AuthID == authID
+	})
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteUserAuth(ctx context.Context, userID int32, authID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := s.deleteAuthWhere(func(a database.Auth) bool {
+		return a.AuthID == authID && a.UserID == userID
+	})
+	if deleted == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteOtherAuth(ctx context.Context, auth models.AuthDetails) (deleted int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(s.deleteAuthWhere(func(a database.Auth) bool {
+		return a.UserID == auth.UserID && a.AuthUuid != auth.AuthUUID
+	})), nil
+}
+
+func (s *MemoryStore) DeleteAllAuth(ctx context.Context, userID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteAuthWhere(func(a database.Auth) bool {
+		return a.UserID == userID
+	})
+	return nil
+}
+
+func (s *MemoryStore) CheckAuthExists(ctx context.Context, auth models.AuthDetails) (exists bool, err error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, a := range s.auths {
+		if a.UserID == auth.UserID && a.AuthUuid == auth.AuthUUID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) TouchAuth(ctx context.Context, auth models.AuthDetails, policy SessionPolicy) (exists bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for i := range s.auths {
+		if s.auths[i].UserID == auth.UserID && s.auths[i].AuthUuid == auth.AuthUUID {
+			if policy.Expired(&s.auths[i], now) {
+				return false, nil
+			}
+			s.auths[i].LastUsedAt = now.UTC()
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) DeleteExpiredAuth(ctx context.Context, policy SessionPolicy, limit int32) (deleted int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	return int64(s.deleteAuthWhere(func(a database.Auth) bool {
+		if deleted >= int64(limit) || !policy.Expired(&a, now) {
+			return false
+		}
+		deleted++
+		return true
+	})), nil
+}
+
+func (s *MemoryStore) CountLiveAuth(ctx context.Context, userID int32, policy SessionPolicy) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return int64(len(s.liveAuth(userID, policy))), nil
+}
+
+func (s *MemoryStore) DeleteLeastRecentlyUsedAuth(ctx context.Context, userID int32, policy SessionPolicy, limit int32) (deleted int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	live := s.liveAuth(userID, policy)
+	sort.Slice(live, func(i, j int) bool {
+		if !live[i].LastUsedAt.Equal(live[j].LastUsedAt) {
+			return live[i].LastUsedAt.Before(live[j].LastUsedAt)
+		}
+		return live[i].AuthID < live[j].AuthID
+	})
+
+	evicted := map[int32]bool{}
+	for _, a := range live {
+		if len(evicted) >= int(limit) {
+			break
+		}
+		evicted[a.AuthID] = true
+	}
+
+	return int64(s.deleteAuthWhere(func(a database.Auth) bool {
+		return evicted[a.AuthID]
+	})), nil
+}
+
+func (s *MemoryStore) CreateRefreshToken(ctx context.Context, authID int32, tokenHash string, expiresAt time.Time) (*database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	found := false
+	for _, a := range s.auths {
+		if a.AuthID == authID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return &database.RefreshToken{}, ErrSessionNotFound
+	}
+
+	s.nextRefreshTokenID++
+	refreshToken := database.RefreshToken{
+		RefreshTokenID: s.nextRefreshTokenID,
+		AuthID:         authID,
+		TokenHash:      tokenHash,
+		CreatedAt:      time.Now().UTC(),
+		ExpiresAt:      expiresAt.UTC(),
+	}
+	s.refreshTokens = append(s.refreshTokens, refreshToken)
+
+	return &refreshToken, nil
+}
+
+func (s *MemoryStore) GetRefreshToken(ctx context.Context, tokenHash string) (*database.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, refreshToken := range s.refreshTokens {
+		if refreshToken.TokenHash == tokenHash {
+			found := refreshToken
+			return &found, nil
+		}
+	}
+	return &database.RefreshToken{}, ErrRefreshTokenNotFound
+}
+
+func (s *MemoryStore) UseRefreshToken(ctx context.Context, refreshTokenID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.refreshTokens {
+		refreshToken := &s.refreshTokens[i]
+		if refreshToken.RefreshTokenID == refreshTokenID && !refreshToken.UsedAt.Valid {
+			refreshToken.UsedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+			return nil
+		}
+	}
+	return ErrRefreshTokenReused
+}
+
+func (s *MemoryStore) DeleteExpiredRefreshTokens(ctx context.Context, limit int32) (deleted int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	keptTokens := []database.RefreshToken{}
+	for _, refreshToken := range s.refreshTokens {
+		if deleted < int64(limit) && refreshToken.ExpiresAt.Before(now) {
+			deleted++
+			continue
+		}
+		keptTokens = append(keptTokens, refreshToken)
+	}
+	s.refreshTokens = keptTokens
+
+	return deleted, nil
+}
+
+func (s *MemoryStore) CreateVerificationToken(ctx context.Context, userID int32, purpose string, tokenHash string, expiresAt time.Time) (*database.VerificationToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.userByID(userID); !ok {
+		return &database.VerificationToken{}, ErrUserNotFound
+	}
+
+	s.nextVerificationTokenID++
+	verificationToken := database.VerificationToken{
+		VerificationTokenID: s.nextVerificationTokenID,
+		UserID:              userID,
+		Purpose:             purpose,
+		TokenHash:           tokenHash,
+		CreatedAt:           time.Now().UTC(),
+		ExpiresAt:           expiresAt.UTC(),
+	}
+	s.verificationTokens = append(s.verificationTokens, verificationToken)
+
+	return &verificationToken, nil
+}
+
+func (s *MemoryStore) ConsumeVerificationToken(ctx context.Context, purpose string, tokenHash string) (*database.VerificationToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for i := range s.verificationTokens {
+		verificationToken := &s.verificationTokens[i]
+		if verificationToken.TokenHash == tokenHash && verificationToken.Purpose == purpose &&
+			!verificationToken.ConsumedAt.Valid && verificationToken.ExpiresAt.After(now) {
+			verificationToken.ConsumedAt = sql.NullTime{Time: now, Valid: true}
+			consumed := *verificationToken
+			return &consumed, nil
+		}
+	}
+	return &database.VerificationToken{}, ErrVerificationTokenInvalid
+}
+
+func (s *MemoryStore) DeleteStaleVerificationTokens(ctx context.Context, limit int32) (deleted int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	keptTokens := []database.VerificationToken{}
+	for _, verificationToken := range s.verificationTokens {
+		if deleted < int64(limit) && (verificationToken.ConsumedAt.Valid || verificationToken.ExpiresAt.Before(now)) {
+			deleted++
+			continue
+		}
+		keptTokens = append(keptTokens, verificationToken)
+	}
+	s.verificationTokens = keptTokens
+
+	return deleted, nil
+}
+
+func (s *MemoryStore) CreateOAuthClient(ctx context.Context, c *models.OAuthClient) (*database.OauthClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.oauthClients[c.ClientID]; ok {
+		return &database.OauthClient{}, ErrClientIDTaken
+	}
+
+	client := database.OauthClient{
+		ClientID:         c.ClientID,
+		ClientName:       c.Name,
+		ClientSecretHash: sql.NullString{String: c.SecretHash, Valid: c.SecretHash != ""},
+		RedirectUris:     append([]string{}, c.RedirectURIs...),
+		Scopes:           append([]string{}, c.Scopes...),
+		CreatedAt:        time.Now().UTC(),
+		Audience:         append([]string{}, c.Audience...),
+	}
+	s.oauthClients[c.ClientID] = &client
+
+	created := client
+	return &created, nil
+}
+
+func (s *MemoryStore) GetOAuthClient(ctx context.Context, clientID string) (*database.OauthClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, ok := s.oauthClients[clientID]
+	if !ok {
+		return &database.OauthClient{}, ErrClientNotFound
+	}
+
+	found := *client
+	return &found, nil
+}
+
+func (s *MemoryStore) ListOAuthClients(ctx context.Context) (*[]database.OauthClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clients := []database.OauthClient{}
+	for _, client := range s.oauthClients {
+		clients = append(clients, *client)
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		if !clients[i].CreatedAt.Equal(clients[j].CreatedAt) {
+			return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+		}
+		return clients[i].ClientID < clients[j].ClientID
+	})
+
+	return &clients, nil
+}
+
+func (s *MemoryStore) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.oauthClients[clientID]; !ok {
+		return ErrClientNotFound
+	}
+	delete(s.oauthClients, clientID)
+
+	// Sessions and codes reference the client with ON DELETE CASCADE
+	s.deleteAuthWhere(func(a database.Auth) bool {
+		return a.ClientID.Valid && a.ClientID.String == clientID
+	})
+	for codeHash, code := range s.authCodes {
+		if code.ClientID == clientID {
+			delete(s.authCodes, codeHash)
+		}
+	}
+
+	return nil
+}
+
+func (s *MemoryStore) CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.oauthClients[code.ClientID]; !ok {
+		return ErrClientNotFound
+	}
+	if _, ok := s.userByID(code.UserID); !ok {
+		return ErrUserNotFound
+	}
+
+	s.authCodes[code.CodeHash] = database.OauthAuthorizationCode{
+		CodeHash:            code.CodeHash,
+		ClientID:            code.ClientID,
+		UserID:              code.UserID,
+		RedirectUri:         code.RedirectURI,
+		RedirectUriExplicit: code.RedirectURIExplicit,
+		Scope:               code.Scope,
+		CodeChallenge:       code.CodeChallenge,
+		CreatedAt:           time.Now().UTC(),
+		ExpiresAt:           code.ExpiresAt.UTC(),
+		Nonce:               code.Nonce,
+	}
+	return nil
+}
+
+func (s *MemoryStore) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*database.OauthAuthorizationCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.authCodes[codeHash]
+	if !ok || !code.ExpiresAt.After(time.Now().UTC()) {
+		return &database.OauthAuthorizationCode{}, ErrAuthCodeInvalid
+	}
+	delete(s.authCodes, codeHash)
+
+	return &code, nil
+}
+
+func (s *MemoryStore) DeleteExpiredAuthorizationCodes(ctx context.Context, limit int32) (deleted int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for codeHash, code := range s.authCodes {
+		if deleted >= int64(limit) {
+			break
+		}
+		if code.ExpiresAt.Before(now) {
+			delete(s.authCodes, codeHash)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// InTx runs f and restores the store to its previous state if f returns an error.
+// Transactions are serialised, but writes made outside of InTx while f runs are
+// not isolated from it and are lost on rollback.
+func (s *MemoryStore) InTx(ctx context.Context, f func(Storage) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.RLock()
+	snapshot := s.copyData()
+	s.mu.RUnlock()
+
+	if err := f(memoryTx{s}); err != nil {
+		s.mu.Lock()
+		s.restoreData(snapshot)
+		s.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// copyData returns a store holding a deep copy of the data, but not the ID counters. Callers must hold s.mu.
+func (s *MemoryStore) copyData() *MemoryStore {
+	c := &MemoryStore{
+		users:                make(map[string]*database.User, len(s.users)),
+		auths:                append([]database.Auth(nil), s.auths...),
+		refreshTokens:        append([]database.RefreshToken(nil), s.refreshTokens...),
+		verificationTokens:   append([]database.VerificationToken(nil), s.verificationTokens...),
+		oauthClients:         make(map[string]*database.OauthClient, len(s.oauthClients)),
+		authCodes:            make(map[string]database.OauthAuthorizationCode, len(s.authCodes)),
+		personalAccessTokens: append([]database.PersonalAccessToken(nil), s.personalAccessTokens...),
+		serviceClients:       make(map[string]*database.ServiceClient, len(s.serviceClients)),
+		deviceCodes:          make(map[string]database.DeviceCode, len(s.deviceCodes)),
+		hmacKeys:             append([]database.JwtHmacKey(nil), s.hmacKeys...),
+	}
+
+	for email, user := range s.users {
+		u := *user
+		c.users[email] = &u
+	}
+	for clientID, client := range s.oauthClients {
+		oc := *client
+		c.oauthClients[clientID] = &oc
+	}
+	for codeHash, code := range s.authCodes {
+		c.authCodes[codeHash] = code
+	}
+	for clientID, client := range s.serviceClients {
+		sc := *client
+		c.serviceClients[clientID] = &sc
+	}
+	for codeHash, code := range s.deviceCodes {
+		c.deviceCodes[codeHash] = code
+	}
+
+	return c
+}
+
+// restoreData puts back data saved by copyData. Callers must hold s.mu.
+func (s *MemoryStore) restoreData(c *MemoryStore) {
+	s.users = c.users
+	s.auths = c.auths
+	s.refreshTokens = c.refreshTokens
+	s.verificationTokens = c.verificationTokens
+	s.oauthClients = c.oauthClients
+	s.authCodes = c.authCodes
+	s.personalAccessTokens = c.personalAccessTokens
+	s.serviceClients = c.serviceClients
+	s.deviceCodes = c.deviceCodes
+	s.hmacKeys = c.hmacKeys
+}
+
+func (s *MemoryStore) CreatePersonalAccessToken(ctx context.Context, t *models.PersonalAccessToken) (*database.PersonalAccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.userByID(t.UserID); !ok {
+		return &database.PersonalAccessToken{}, ErrUserNotFound
+	}
+
+	s.nextPersonalAccessTokenID++
+	token := database.PersonalAccessToken{
+		PersonalAccessTokenID: s.nextPersonalAccessTokenID,
+		UserID:                t.UserID,
+		Name:                  t.Name,
+		TokenHash:             t.TokenHash,
+		Scopes:                append([]string(nil), t.Scopes...),
+		CreatedAt:             time.Now().UTC(),
+		ExpiresAt:             sql.NullTime{Time: t.ExpiresAt.UTC(), Valid: !t.ExpiresAt.IsZero()},
+	}
+	s.personalAccessTokens = append(s.personalAccessTokens, token)
+
+	return &token, nil
+}
+
+func (s *MemoryStore) ListPersonalAccessTokens(ctx context.Context, userID int32) (*[]database.PersonalAccessToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := []database.PersonalAccessToken{}
+	for i := len(s.personalAccessTokens) - 1; i >= 0; i-- {
+		if s.personalAccessTokens[i].UserID == userID {
+			tokens = append(tokens, s.personalAccessTokens[i])
+		}
+	}
+	return &tokens, nil
+}
+
+func (s *MemoryStore) DeletePersonalAccessToken(ctx context.Context, userID int32, tokenID int32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, token := range s.personalAccessTokens {
+		if token.PersonalAccessTokenID == tokenID && token.UserID == userID {
+			s.personalAccessTokens = append(s.personalAccessTokens[:i:i], s.personalAccessTokens[i+1:]...)
+			return nil
+		}
+	}
+	return ErrPersonalAccessTokenNotFound
+}
+
+func (s *MemoryStore) UsePersonalAccessToken(ctx context.Context, tokenHash string) (*database.PersonalAccessToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for i := range s.personalAccessTokens {
+		token := &s.personalAccessTokens[i]
+		if token.TokenHash != tokenHash {
+			continue
+		}
+		if token.ExpiresAt.Valid && !token.ExpiresAt.Time.After(now) {
+			break
+		}
+		token.LastUsedAt = sql.NullTime{Time: now, Valid: true}
+		used := *token
+		return &used, nil
+	}
+	return &database.PersonalAccessToken{}, ErrPersonalAccessTokenNotFound
+}
+
+func (s *MemoryStore) CreateServiceClient(ctx context.Context, c *models.ServiceClient) (*database.ServiceClient, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.serviceClients[c.ClientID]; ok {
+		return &database.ServiceClient{}, ErrClientIDTaken
+	}
+
+	client := database.ServiceClient{
+		ClientID:         c.ClientID,
+		ClientName:       c.Name,
+		ClientSecretHash: c.SecretHash,
+		Scopes:           append([]string{}, c.Scopes...),
+		CreatedAt:        time.Now().UTC(),
+		Audience:         append([]string{}, c.Audience...),
+	}
+	s.serviceClients[c.ClientID] = &client
+
+	created := client
+	return &created, nil
+}
+
+func (s *MemoryStore) GetServiceClient(ctx context.Context, clientID string) (*database.ServiceClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, ok := s.serviceClients[clientID]
+	if !ok {
+		return &database.ServiceClient{}, ErrServiceClientNotFound
+	}
+
+	found := *client
+	return &found, nil
+}
+
+func (s *MemoryStore) ListServiceClients(ctx context.Context) (*[]database.ServiceClient, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clients := []database.ServiceClient{}
+	for _, client := range s.serviceClients {
+		clients = append(clients, *client)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if !clients[i].CreatedAt.Equal(clients[j].CreatedAt) {
+			return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+		}
+		return clients[i].ClientID < clients[j].ClientID
+	})
+
+	return &clients, nil
+}
+
+func (s *MemoryStore) DeleteServiceClient(ctx context.Context, clientID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.serviceClients[clientID]; !ok {
+		return ErrServiceClientNotFound
+	}
+	delete(s.serviceClients, clientID)
+	return nil
+}
+
+func (s *MemoryStore) CreateDeviceCode(ctx context.Context, code *models.DeviceCode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.deviceCodes {
+		if c.UserCode == code.UserCode {
+			return ErrUserCodeTaken
+		}
+	}
+
+	s.deviceCodes[code.DeviceCodeHash] = database.DeviceCode{
+		DeviceCodeHash: code.DeviceCodeHash,
+		UserCode:       code.UserCode,
+		DeviceName:     code.DeviceName,
+		Status:         models.DeviceCodePending,
+		CreatedAt:      time.Now().UTC(),
+		ExpiresAt:      code.ExpiresAt.UTC(),
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetDeviceCode(ctx context.Context, deviceCodeHash string) (*database.DeviceCode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	code, ok := s.deviceCodes[deviceCodeHash]
+	if !ok {
+		return &database.DeviceCode{}, ErrDeviceCodeNotFound
+	}
+	return &code, nil
+}
+
+func (s *MemoryStore) GetPendingDeviceCode(ctx context.Context, userCode string) (*database.DeviceCode, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	code, ok := s.pendingDeviceCode(userCode)
+	if !ok {
+		return &database.DeviceCode{}, ErrDeviceCodeNotFound
+	}
+	return &code, nil
+}
+
+func (s *MemoryStore) DecideDeviceCode(ctx context.Context, userCode string, userID int32, approved bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.pendingDeviceCode(userCode)
+	if !ok {
+		return ErrDeviceCodeNotFound
+	}
+	if _, ok := s.userByID(userID); !ok {
+		return ErrUserNotFound
+	}
+
+	code.Status = models.DeviceCodeDenied
+	if approved {
+		code.Status = models.DeviceCodeApproved
+	}
+	code.UserID = sql.NullInt32{Int32: userID, Valid: true}
+	s.deviceCodes[code.DeviceCodeHash] = code
+	return nil
+}
+
+func (s *MemoryStore) MarkDeviceCodePolled(ctx context.Context, deviceCodeHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.deviceCodes[deviceCodeHash]
+	if !ok {
+		return nil
+	}
+	code.LastPolledAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	s.deviceCodes[deviceCodeHash] = code
+	return nil
+}
+
+func (s *MemoryStore) ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) (*database.DeviceCode, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code, ok := s.deviceCodes[deviceCodeHash]
+	if !ok {
+		return &database.DeviceCode{}, ErrDeviceCodeNotFound
+	}
+	delete(s.deviceCodes, deviceCodeHash)
+
+	return &code, nil
+}
+
+func (s *MemoryStore) DeleteExpiredDeviceCodes(ctx context.Context, limit int32) (deleted int64, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for deviceCodeHash, code := range s.deviceCodes {
+		if deleted >= int64(limit) {
+			break
+		}
+		if code.ExpiresAt.Before(now) {
+			delete(s.deviceCodes, deviceCodeHash)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+func (s *MemoryStore) CreateHMACKey(ctx context.Context, kid string, secret []byte) (*database.JwtHmacKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, key := range s.hmacKeys {
+		if key.Kid == kid {
+			return &database.JwtHmacKey{}, ErrHMACKeyTaken
+		}
+	}
+
+	key := database.JwtHmacKey{
+		Kid:       kid,
+		Secret:    append([]byte{}, secret...),
+		CreatedAt: time.Now().UTC(),
+	}
+	s.hmacKeys = append(s.hmacKeys, key)
+
+	return &key, nil
+}
+
+func (s *MemoryStore) ListHMACKeys(ctx context.Context) (*[]database.JwtHmacKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := append([]database.JwtHmacKey{}, s.hmacKeys...)
+	return &keys, nil
+}
+
+func (s *MemoryStore) PromoteHMACKey(ctx context.Context, kid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.hmacKeys {
+		if s.hmacKeys[i].Kid == kid {
+			s.hmacKeys[i].PromotedAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+			return nil
+		}
+	}
+	return ErrHMACKeyNotFound
+}
+
+func (s *MemoryStore) RetireHMACKey(ctx context.Context, kid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, key := range s.hmacKeys {
+		if key.Kid == kid {
+			s.hmacKeys = append(s.hmacKeys[:i], s.hmacKeys[i+1:]...)
+			return nil
+		}
+	}
+	return ErrHMACKeyNotFound
+}
+
+// memoryTx is the store handed to InTx callbacks, so nested calls join the running transaction
+type memoryTx struct {
+	*MemoryStore
+}
+
+func (tx memoryTx) InTx(ctx context.Context, f func(Storage) error) error {
+	return f(tx)
+}
+
+// pendingDeviceCode finds an unexpired, undecided code by its user code. Callers must hold s.mu.
+func (s *MemoryStore) pendingDeviceCode(userCode string) (database.DeviceCode, bool) {
+	now := time.Now().UTC()
+	for _, code := range s.deviceCodes {
+		if code.UserCode == userCode && code.Status == models.DeviceCodePending && code.ExpiresAt.After(now) {
+			return code, true
+		}
+	}
+	return database.DeviceCode{}, false
+}
+
+// liveAuth returns the user's first-party sessions that have not run out under the policy.
+// Callers must hold s.mu.
+func (s *MemoryStore) liveAuth(userID int32, policy SessionPolicy) []database.Auth {
+	now := time.Now()
+	live := []database.Auth{}
+	for _, a := range s.auths {
+		if a.UserID == userID && !a.ClientID.Valid && !policy.Expired(&a, now) {
+			live = append(live, a)
+		}
+	}
+	return live
+}
+
+// userByID finds a user by primary key. Callers must hold s.mu.
+func (s *MemoryStore) userByID(userID int32) (*database.User, bool) {
+	for _, user := range s.users {
+		if user.UserID == userID {
+			return user, true
+		}
+	}
+	return nil, false
+}
+
+// deleteAuthWhere removes every auth row matching the predicate, cascading to their refresh tokens,
+// and returns how many were removed. Callers must hold s.mu.
+func (s *MemoryStore) deleteAuthWhere(match func(database.Auth) bool) (deleted int) {
+	kept := []database.Auth{}
+	removed := map[int32]bool{}
+	for _, a := range s.auths {
+		if match(a) {
+			deleted++
+			removed[a.AuthID] = true
+			continue
+		}
+		kept = append(kept, a)
+	}
+	s.auths = kept
+
+	keptTokens := []database.RefreshToken{}
+	for _, refreshToken := range s.refreshTokens {
+		if !removed[refreshToken.AuthID] {
+			keptTokens = append(keptTokens, refreshToken)
+		}
+	}
+	s.refreshTokens = keptTokens
+
+	return deleted
+}
@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The runner shares goose's version table, so databases previously migrated
+// with the goose CLI are picked up where they left off.
+const migrationsTable = "goose_db_version"
+
+// Arbitrary key for pg_advisory_lock so that instances starting together don't migrate concurrently
+const migrationsLockKey = 7245120973
+
+type Migration struct {
+	Version       int64
+	Name          string
+	Up            string
+	Down          string
+	NoTransaction bool
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+func NewMigrator(db *sql.DB, fsys fs.FS) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+// Reads every NNN_name.sql file in the root of fsys, ordered by version
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []Migration{}
+	seen := map[int64]string{}
+
+	for _, name := range names {
+		versionStr, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %v is not named NNN_description.sql", name)
+		}
+
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %v has an invalid version", name)
+		}
+
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %v and %v share version %v", other, name, version)
+		}
+		seen[version] = name
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, err := parseMigration(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("migration %v: %w", name, err)
+		}
+		migration.Version = version
+		migration.Name = strings.TrimSuffix(path.Base(name), ".sql")
+
+		migrations = append(migrations, migration)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Splits a goose annotated file into its up and down sections. Each section is
+// executed as a single multi-statement query, so StatementBegin/End are not needed.
+func parseMigration(content string) (Migration, error) {
+	migration := Migration{}
+	var up, down strings.Builder
+	var section *strings.Builder
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		annotation, isAnnotation := strings.CutPrefix(strings.TrimSpace(line), "-- +goose ")
+
+		if !isAnnotation {
+			if section != nil {
+				section.WriteString(line)
+				section.WriteString("\n")
+			}
+			continue
+		}
+
+		switch strings.TrimSpace(annotation) {
+		case "Up":
+			section = &up
+		case "Down":
+			section = &down
+		case "NO TRANSACTION":
+			migration.NoTransaction = true
+		case "StatementBegin", "StatementEnd":
+		default:
+			return migration, fmt.Errorf("unknown goose annotation %q", annotation)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return migration, err
+	}
+
+	migration.Up = strings.TrimSpace(up.String())
+	migration.Down = strings.TrimSpace(down.String())
+	if migration.Up == "" {
+		return migration, errors.New("missing -- +goose Up section")
+	}
+
+	return migration, nil
+}
+
+// Applies every pending migration in order and returns the ones that were applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	applied := []Migration{}
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.Applied {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, status.Migration, status.Migration.Up, true); err != nil {
+				return err
+			}
+			applied = append(applied, status.Migration)
+		}
+		return nil
+	})
+
+	return applied, err
+}
+
+// Rolls back the most recently applied migration. Returns nil if nothing is applied.
+func (m *Migrator) Down(ctx context.Context) (*Migration, error) {
+	var rolledBack *Migration
+
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		statuses, err := m.status(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(statuses) - 1; i >= 0; i-- {
+			if !statuses[i].Applied {
+				continue
+			}
+
+			migration := statuses[i].Migration
+			if err := m.apply(ctx, conn, migration, migration.Down, false); err != nil {
+				return err
+			}
+			rolledBack = &migration
+			return nil
+		}
+		return nil
+	})
+
+	return rolledBack, err
+}
+
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := m.withLock(ctx, func(conn *sql.Conn) (err error) {
+		statuses, err = m.status(ctx, conn)
+		return
+	})
+
+	return statuses, err
+}
+
+func (m *Migrator) withLock(ctx context.Context, f func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationsLockKey); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationsLockKey)
+
+	if err := m.ensureVersionTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return f(conn)
+}
+
+func (m *Migrator) ensureVersionTable(ctx context.Context, conn *sql.Conn) error {
+	var exists bool
+	err := conn.QueryRowContext(ctx, "SELECT to_regclass($1) IS NOT NULL", migrationsTable).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE `+migrationsTable+` (
+			id SERIAL PRIMARY KEY,
+			version_id BIGINT NOT NULL,
+			is_applied BOOLEAN NOT NULL,
+			tstamp TIMESTAMP DEFAULT now()
+		);
+		INSERT INTO `+migrationsTable+` (version_id, is_applied) VALUES (0, TRUE);
+	`)
+	return err
+}
+
+func (m *Migrator) status(ctx context.Context, conn *sql.Conn) ([]MigrationStatus, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version_id, is_applied, tstamp FROM "+migrationsTable+" ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// The latest row for a version decides whether it is currently applied
+	latest := map[int64]MigrationStatus{}
+	for rows.Next() {
+		var version int64
+		var applied bool
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&version, &applied, &appliedAt); err != nil {
+			return nil, err
+		}
+		if _, ok := latest[version]; !ok {
+			latest[version] = MigrationStatus{Applied: applied, AppliedAt: appliedAt.Time}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := latest[migration.Version]
+		status.Migration = migration
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, statements string, up bool) error {
+	record := func(db interface {
+		ExecContext(context.Context, string, ...any) (sql.Result, error)
+	}) error {
+		if statements != "" {
+			if _, err := db.ExecContext(ctx, statements); err != nil {
+				return fmt.Errorf("migration %v: %w", migration.Name, err)
+			}
+		}
+		_, err := db.ExecContext(ctx, "INSERT INTO "+migrationsTable+" (version_id, is_applied) VALUES ($1, $2)", migration.Version, up)
+		return err
+	}
+
+	if migration.NoTransaction {
+		return record(conn)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/yuanzix/userAuth/sql/migrations"
+)
+
+func TestParseMigration(t *testing.T) {
+	migration, err := parseMigration(`-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE a (id INT);
+-- +goose StatementEnd
+
+CREATE INDEX a_id_idx ON a (id);
+
+-- +goose Down
+DROP TABLE a;
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantUp := "CREATE TABLE a (id INT);\n\nCREATE INDEX a_id_idx ON a (id);"
+	if migration.Up != wantUp {
+		t.Errorf("got up %q, want %q", migration.Up, wantUp)
+	}
+	if migration.Down != "DROP TABLE a;" {
+		t.Errorf("got down %q", migration.Down)
+	}
+	if migration.NoTransaction {
+		t.Error("the migration was marked NO TRANSACTION")
+	}
+}
+
+func TestParseMigrationNoTransaction(t *testing.T) {
+	migration, err := parseMigration("-- +goose NO TRANSACTION\n-- +goose Up\nCREATE INDEX CONCURRENTLY a_id_idx ON a (id);\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !migration.NoTransaction || migration.Down != "" {
+		t.Fatalf("got %+v", migration)
+	}
+}
+
+func TestParseMigrationRejects(t *testing.T) {
+	tests := map[string]string{
+		"no up section":      "-- +goose Down\nDROP TABLE a;\n",
+		"empty up section":   "-- +goose Up\n\n-- +goose Down\nDROP TABLE a;\n",
+		"unknown annotation": "-- +goose Up\nSELECT 1;\n-- +goose Sideways\n",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseMigration(content); err == nil {
+				t.Fatal("the migration was accepted")
+			}
+		})
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	loaded, err := LoadMigrations(fstest.MapFS{
+		"002_second.sql": {Data: []byte("-- +goose Up\nSELECT 2;\n")},
+		"001_first.sql":  {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+		"README.md":      {Data: []byte("not a migration")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 2 || loaded[0].Version != 1 || loaded[0].Name != "001_first" || loaded[1].Version != 2 {
+		t.Fatalf("got %+v", loaded)
+	}
+
+	_, err = LoadMigrations(fstest.MapFS{
+		"001_first.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+		"01_again.sql":  {Data: []byte("-- +goose Up\nSELECT 1;\n")},
+	})
+	if err == nil {
+		t.Fatal("two migrations sharing a version were accepted")
+	}
+}
+
+// Every migration shipped with the binary must parse and be reversible
+func TestEmbeddedMigrations(t *testing.T) {
+	loaded, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, migration := range loaded {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %v has version %v, want %v", migration.Name, migration.Version, i+1)
+		}
+		if migration.Down == "" {
+			t.Errorf("migration %v has no down section", migration.Name)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+// Trims surrounding whitespace and lowercases the domain, which is always case-insensitive.
+// The local part may legally be case-sensitive, so it is only lowercased when asked to.
+func NormalizeEmail(email string, lowercaseLocalPart bool) (string, error) {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndex(email, "@")
+	if at < 1 || at == len(email)-1 || strings.ContainsAny(email, " \t\r\n") {
+		return "", errors.New("invalid email address")
+	}
+
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+	if lowercaseLocalPart {
+		local = strings.ToLower(local)
+	}
+
+	return local + "@" + domain, nil
+}
@@ -0,0 +1,36 @@
+package utils
+
+import "testing"
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		email              string
+		lowercaseLocalPart bool
+		want               string
+	}{
+		{"jane@example.com", false, "jane@example.com"},
+		{"  Jane.Doe@Example.COM \n", false, "Jane.Doe@example.com"},
+		{"Jane.Doe@Example.COM", true, "jane.doe@example.com"},
+		// Only the last @ separates the domain, quoted local parts may contain one
+		{`"a@b"@Example.com`, false, `"a@b"@example.com`},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeEmail(tt.email, tt.lowercaseLocalPart)
+		if err != nil {
+			t.Errorf("NormalizeEmail(%q) failed: %v", tt.email, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeEmail(%q, %v) = %q, want %q", tt.email, tt.lowercaseLocalPart, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeEmailRejects(t *testing.T) {
+	for _, email := range []string{"", "   ", "jane", "@example.com", "jane@", "jane doe@example.com", "jane@exa\tmple.com"} {
+		if got, err := NormalizeEmail(email, false); err == nil {
+			t.Errorf("NormalizeEmail(%q) = %q, want an error", email, got)
+		}
+	}
+}
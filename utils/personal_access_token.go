@@ -0,0 +1,22 @@
+package utils
+
+import "strings"
+
+// Personal access tokens start with this prefix, which tells them apart from session
+// tokens and lets secret scanners recognise them in leaked code and logs
+const PersonalAccessTokenPrefix = "uat_"
+
+// Generates a personal access token along with the hash it is stored under
+func GeneratePersonalAccessToken() (token string, hash string, err error) {
+	token, _, err = GenerateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	token = PersonalAccessTokenPrefix + token
+	return token, HashOpaqueToken(token), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
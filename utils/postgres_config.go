@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type PostgresConfig struct {
+	// DATABASE_URL, either a postgres:// URL or key=value pairs. Takes precedence over the individual fields.
+	DSN string
+
+	Host     string
+	Port     string
+	User     string
+	DBName   string
+	Password string
+
+	SSLMode     string
+	SSLRootCert string
+
+	// Pool limits, zero keeps the database/sql defaults
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// Extra pings attempted on startup, waiting ConnectBackoff before the first and doubling it each time
+	ConnectRetries int
+	ConnectBackoff time.Duration
+
+	QueryTimeout time.Duration
+}
+
+var postgresConfigKeys = []string{
+	"DATABASE_URL",
+	"POSTGRES_HOST", "POSTGRES_PORT", "POSTGRES_USER", "POSTGRES_DB", "POSTGRES_PASSWORD",
+	"POSTGRES_SSLMODE", "POSTGRES_SSLROOTCERT",
+	"POSTGRES_MAX_OPEN_CONNS", "POSTGRES_MAX_IDLE_CONNS", "POSTGRES_CONN_MAX_LIFETIME", "POSTGRES_CONN_MAX_IDLE_TIME",
+	"POSTGRES_CONNECT_RETRIES", "POSTGRES_CONNECT_BACKOFF",
+	"POSTGRES_QUERY_TIMEOUT",
+}
+
+// Reads the connection settings from .env, falling back to the process environment.
+// Either DATABASE_URL or all of POSTGRES_HOST, POSTGRES_PORT, POSTGRES_USER, POSTGRES_DB and POSTGRES_PASSWORD are required.
+func ReadPostgresConfig() (config PostgresConfig, err error) {
+	values, err := readEnvValues(postgresConfigKeys...)
+	if err != nil {
+		return config, err
+	}
+
+	config = PostgresConfig{
+		DSN:            values["DATABASE_URL"],
+		Host:           values["POSTGRES_HOST"],
+		Port:           values["POSTGRES_PORT"],
+		User:           values["POSTGRES_USER"],
+		DBName:         values["POSTGRES_DB"],
+		Password:       values["POSTGRES_PASSWORD"],
+		SSLMode:        values["POSTGRES_SSLMODE"],
+		SSLRootCert:    values["POSTGRES_SSLROOTCERT"],
+		ConnectBackoff: time.Second,
+		QueryTimeout:   defaultQueryTimeout,
+	}
+
+	if config.DSN == "" && (config.Host == "" || config.Port == "" || config.User == "" || config.DBName == "" || config.Password == "") {
+		return config, errors.New("missing required environment postgres variables")
+	}
+
+	for key, target := range map[string]*int{
+		"POSTGRES_MAX_OPEN_CONNS":  &config.MaxOpenConns,
+		"POSTGRES_MAX_IDLE_CONNS":  &config.MaxIdleConns,
+		"POSTGRES_CONNECT_RETRIES": &config.ConnectRetries,
+	} {
+		if *target, err = parseEnvInt(values, key, *target); err != nil {
+			return config, err
+		}
+	}
+
+	for key, target := range map[string]*time.Duration{
+		"POSTGRES_CONN_MAX_LIFETIME":  &config.ConnMaxLifetime,
+		"POSTGRES_CONN_MAX_IDLE_TIME": &config.ConnMaxIdleTime,
+		"POSTGRES_CONNECT_BACKOFF":    &config.ConnectBackoff,
+		"POSTGRES_QUERY_TIMEOUT":      &config.QueryTimeout,
+	} {
+		if *target, err = parseEnvDuration(values, key, *target); err != nil {
+			return config, err
+		}
+	}
+
+	if config.QueryTimeout == 0 {
+		return config, errors.New("POSTGRES_QUERY_TIMEOUT must be greater than zero")
+	}
+
+	return config, nil
+}
+
+// ConnString builds the lib/pq connection string. sslmode defaults to require unless DATABASE_URL sets it.
+func (c PostgresConfig) ConnString() (string, error) {
+	if c.DSN == "" {
+		sslMode := c.SSLMode
+		if sslMode == "" {
+			sslMode = "require"
+		}
+
+		params := [][2]string{
+			{"host", c.Host},
+			{"port", c.Port},
+			{"user", c.User},
+			{"dbname", c.DBName},
+			{"password", c.Password},
+			{"sslmode", sslMode},
+		}
+		if c.SSLRootCert != "" {
+			params = append(params, [2]string{"sslrootcert", c.SSLRootCert})
+		}
+
+		pairs := []string{}
+		for _, param := range params {
+			pairs = append(pairs, param[0]+"="+quoteConnValue(param[1]))
+		}
+		return strings.Join(pairs, " "), nil
+	}
+
+	if strings.HasPrefix(c.DSN, "postgres://") || strings.HasPrefix(c.DSN, "postgresql://") {
+		u, err := url.Parse(c.DSN)
+		if err != nil {
+			return "", fmt.Errorf("invalid DATABASE_URL: %w", err)
+		}
+
+		query := u.Query()
+		if c.SSLMode != "" && !query.Has("sslmode") {
+			query.Set("sslmode", c.SSLMode)
+		}
+		if c.SSLRootCert != "" && !query.Has("sslrootcert") {
+			query.Set("sslrootcert", c.SSLRootCert)
+		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+
+	dsn := c.DSN
+	if c.SSLMode != "" && !strings.Contains(dsn, "sslmode=") {
+		dsn += " sslmode=" + quoteConnValue(c.SSLMode)
+	}
+	if c.SSLRootCert != "" && !strings.Contains(dsn, "sslrootcert=") {
+		dsn += " sslrootcert=" + quoteConnValue(c.SSLRootCert)
+	}
+	return dsn, nil
+}
+
+// Quotes a value for a key=value connection string so spaces, quotes and backslashes survive
+func quoteConnValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+func parseEnvInt(values map[string]string, key string, fallback int) (int, error) {
+	value, ok := values[key]
+	if !ok {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %v value %q", key, value)
+	}
+	return n, nil
+}
+
+func parseEnvDuration(values map[string]string, key string, fallback time.Duration) (time.Duration, error) {
+	value, ok := values[key]
+	if !ok {
+		return fallback, nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid %v value %q, expected a duration such as 30s or 5m", key, value)
+	}
+	return d, nil
+}
@@ -0,0 +1,70 @@
+package utils
+
+import "testing"
+
+func TestConnString(t *testing.T) {
+	tests := []struct {
+		name   string
+		config PostgresConfig
+		want   string
+	}{
+		{
+			name:   "fields default to sslmode require",
+			config: PostgresConfig{Host: "db", Port: "5432", User: "app", DBName: "auth", Password: "secret"},
+			want:   "host='db' port='5432' user='app' dbname='auth' password='secret' sslmode='require'",
+		},
+		{
+			name:   "fields quote spaces, quotes and backslashes",
+			config: PostgresConfig{Host: "db", Port: "5432", User: "app", DBName: "auth", Password: `it's a \secret`, SSLMode: "disable"},
+			want:   `host='db' port='5432' user='app' dbname='auth' password='it\'s a \\secret' sslmode='disable'`,
+		},
+		{
+			name:   "fields with a root certificate",
+			config: PostgresConfig{Host: "db", Port: "5432", User: "app", DBName: "auth", Password: "secret", SSLMode: "verify-full", SSLRootCert: "/etc/ca.pem"},
+			want:   "host='db' port='5432' user='app' dbname='auth' password='secret' sslmode='verify-full' sslrootcert='/etc/ca.pem'",
+		},
+		{
+			name:   "URL is left alone without settings",
+			config: PostgresConfig{DSN: "postgres://app:secret@db:5432/auth"},
+			want:   "postgres://app:secret@db:5432/auth",
+		},
+		{
+			name:   "URL gains the sslmode it does not set",
+			config: PostgresConfig{DSN: "postgresql://app:secret@db/auth", SSLMode: "disable"},
+			want:   "postgresql://app:secret@db/auth?sslmode=disable",
+		},
+		{
+			name:   "URL keeps its own sslmode",
+			config: PostgresConfig{DSN: "postgres://app@db/auth?sslmode=verify-full", SSLMode: "disable", SSLRootCert: "/etc/ca.pem"},
+			want:   "postgres://app@db/auth?sslmode=verify-full&sslrootcert=%2Fetc%2Fca.pem",
+		},
+		{
+			name:   "key=value DSN gains the sslmode it does not set",
+			config: PostgresConfig{DSN: "host=db dbname=auth", SSLMode: "disable"},
+			want:   "host=db dbname=auth sslmode='disable'",
+		},
+		{
+			name:   "key=value DSN keeps its own sslmode",
+			config: PostgresConfig{DSN: "host=db sslmode=require", SSLMode: "disable"},
+			want:   "host=db sslmode=require",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.ConnString()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConnStringInvalidURL(t *testing.T) {
+	if _, err := (PostgresConfig{DSN: "postgres://app@db:port/auth"}).ConnString(); err == nil {
+		t.Fatal("an invalid DATABASE_URL was accepted")
+	}
+}
@@ -2,121 +2,117 @@ package utils
 
 import (
 	"errors"
+	"fmt"
+	"io/fs"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 )
 
-func ReadPostgresDetails() (host, port, user, dbName, password string, err error) {
+func ReadBackendURL() (url string, err error) {
 	content, err := os.ReadFile(".env")
 	if err != nil {
-		return "", "", "", "", "", err
+		return "", err
 	}
 
 	lines := strings.Split(string(content), "\n")
-	re := regexp.MustCompile(`^(POSTGRES_HOST|POSTGRES_PORT|POSTGRES_USER|POSTGRES_DB|POSTGRES_PASSWORD)=(.*)$`)
+	re := regexp.MustCompile(`^(BACKEND_URL)=(.*)$`)
 
 	for _, line := range lines {
 		matches := re.FindStringSubmatch(line)
 		if len(matches) == 3 {
 			switch matches[1] {
-			case "POSTGRES_HOST":
-				host = matches[2]
-			case "POSTGRES_PORT":
-				port = matches[2]
-			case "POSTGRES_USER":
-				user = matches[2]
-			case "POSTGRES_DB":
-				dbName = matches[2]
-			case "POSTGRES_PASSWORD":
-				password = matches[2]
+			case "BACKEND_URL":
+				url = matches[2]
 			}
 		}
 	}
 
-	if host == "" || port == "" || user == "" || dbName == "" || password == "" {
-		return "", "", "", "", "", errors.New("missing required environment postgres variables")
+	if len(url) == 0 {
+		return "", errors.New("missing required environment variable JWT_SECRET")
 	}
 
-	return host, port, user, dbName, password, nil
+	return
 }
 
-func ReadJWTSecret() (jwtSecret []byte, err error) {
+func ReadGmailDetails() (email, password string, err error) {
 	content, err := os.ReadFile(".env")
 	if err != nil {
-		return []byte{}, err
+		return "", "", err
 	}
 
 	lines := strings.Split(string(content), "\n")
-	re := regexp.MustCompile(`^(JWT_SECRET)=(.*)$`)
+	re := regexp.MustCompile(`^(GMAIL_EMAIL|GMAIL_APP_PASSWORD)=(.*)$`)
 
 	for _, line := range lines {
 		matches := re.FindStringSubmatch(line)
 		if len(matches) == 3 {
 			switch matches[1] {
-			case "JWT_SECRET":
-				jwtSecret = []byte(matches[2])
+			case "GMAIL_EMAIL":
+				email = matches[2]
+			case "GMAIL_APP_PASSWORD":
+				password = matches[2]
 			}
 		}
 	}
 
-	if len(jwtSecret) == 0 {
-		return []byte{}, errors.New("missing required environment variable JWT_SECRET")
+	if email == "" || password == "" {
+		return "", "", errors.New("missing required environment variables GMAIL_EMAIL and GMAIL_APP_PASSWORD")
 	}
 
-	return
+	return email, password, nil
 }
 
-func ReadBackendURL() (url string, err error) {
-	content, err := os.ReadFile(".env")
+// AUTO_MIGRATE is optional and defaults to false
+func ReadAutoMigrate() (autoMigrate bool, err error) {
+	values, err := readEnvValues("AUTO_MIGRATE")
 	if err != nil {
-		return "", err
-	}
-
-	lines := strings.Split(string(content), "\n")
-	re := regexp.MustCompile(`^(BACKEND_URL)=(.*)$`)
-
-	for _, line := range lines {
-		matches := re.FindStringSubmatch(line)
-		if len(matches) == 3 {
-			switch matches[1] {
-			case "BACKEND_URL":
-				url = matches[2]
-			}
-		}
-	}
-
-	if len(url) == 0 {
-		return "", errors.New("missing required environment variable JWT_SECRET")
+		return false, err
 	}
 
-	return
+	return parseEnvBool(values, "AUTO_MIGRATE", false)
 }
 
-func ReadGmailDetails() (email, password string, err error) {
+// Reads the given keys from .env, falling back to the process environment for keys
+// that .env does not set. Keys that are missing or empty in both are left out.
+func readEnvValues(keys ...string) (map[string]string, error) {
 	content, err := os.ReadFile(".env")
-	if err != nil {
-		return "", "", err
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
 	}
 
 	lines := strings.Split(string(content), "\n")
-	re := regexp.MustCompile(`^(GMAIL_EMAIL|GMAIL_APP_PASSWORD)=(.*)$`)
+	re := regexp.MustCompile(`^(` + strings.Join(keys, "|") + `)=(.*)$`)
 
+	values := map[string]string{}
 	for _, line := range lines {
-		matches := re.FindStringSubmatch(line)
-		if len(matches) == 3 {
-			switch matches[1] {
-			case "GMAIL_EMAIL":
-				email = matches[2]
-			case "GMAIL_APP_PASSWORD":
-				password = matches[2]
+		matches := re.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if len(matches) == 3 && strings.TrimSpace(matches[2]) != "" {
+			values[matches[1]] = strings.TrimSpace(matches[2])
+		}
+	}
+
+	for _, key := range keys {
+		if _, ok := values[key]; !ok {
+			if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+				values[key] = value
 			}
 		}
 	}
 
-	if email == "" || password == "" {
-		return "", "", errors.New("missing required environment variables GMAIL_EMAIL and GMAIL_APP_PASSWORD")
+	return values, nil
+}
+
+func parseEnvBool(values map[string]string, key string, fallback bool) (bool, error) {
+	value, ok := values[key]
+	if !ok {
+		return fallback, nil
 	}
 
-	return email, password, nil
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %v value %q", key, value)
+	}
+	return b, nil
 }
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/yuanzix/userAuth/internal/database"
+)
+
+// What happens when a user with the maximum number of sessions logs in again
+type SessionLimitPolicy string
+
+const (
+	// End the user's least recently used session to make room for the new one
+	SessionLimitEvict SessionLimitPolicy = "evict"
+	// Refuse the login until one of the user's sessions has ended
+	SessionLimitReject SessionLimitPolicy = "reject"
+)
+
+// SessionPolicy decides when a session has run out. A zero limit is not enforced.
+type SessionPolicy struct {
+	// Sessions that are not used for this long are ended
+	IdleTimeout time.Duration
+	// Sessions are ended this long after the login that started them, however active they are
+	MaxLifetime time.Duration
+}
+
+// Enabled reports whether sessions can run out at all
+func (p SessionPolicy) Enabled() bool {
+	return p.IdleTimeout > 0 || p.MaxLifetime > 0
+}
+
+// Returns the moments a session must have been last used, and created, no earlier than
+// to still be alive. Limits that are not enforced give the zero time.
+func (p SessionPolicy) Cutoffs(now time.Time) (idleCutoff, lifetimeCutoff time.Time) {
+	if p.IdleTimeout > 0 {
+		idleCutoff = now.Add(-p.IdleTimeout).UTC()
+	}
+	if p.MaxLifetime > 0 {
+		lifetimeCutoff = now.Add(-p.MaxLifetime).UTC()
+	}
+	return idleCutoff, lifetimeCutoff
+}
+
+// Expired reports whether the session has run out
+func (p SessionPolicy) Expired(auth *database.Auth, now time.Time) bool {
+	idleCutoff, lifetimeCutoff := p.Cutoffs(now)
+	return auth.LastUsedAt.Before(idleCutoff) || auth.CreatedAt.Before(lifetimeCutoff)
+}
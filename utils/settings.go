@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Settings are the optional tunables read from .env. Anything left unset keeps its default.
+type Settings struct {
+	// Lowercase the local part of email addresses as well as the domain (EMAIL_LOWERCASE_LOCAL_PART)
+	LowercaseEmailLocalPart bool
+	// How long an access token is accepted for (ACCESS_TOKEN_TTL)
+	AccessTokenTTL time.Duration
+	// How long a refresh token can be exchanged for a new token pair (REFRESH_TOKEN_TTL)
+	RefreshTokenTTL time.Duration
+	// How long the link in a verification email stays valid (VERIFICATION_TOKEN_TTL)
+	VerificationTokenTTL time.Duration
+	// Take the client address of a session from X-Forwarded-For, for servers behind a single reverse proxy (TRUST_PROXY_HEADERS)
+	TrustProxyHeaders bool
+	// Let browser clients keep their session in HttpOnly cookies instead of handling tokens (COOKIE_SESSIONS)
+	CookieSessions bool
+	// Mark the session cookies Secure, only turn this off for local development over plain HTTP (COOKIE_SECURE)
+	CookieSecure bool
+	// SameSite attribute of the session cookies: lax, strict or none (COOKIE_SAMESITE)
+	CookieSameSite http.SameSite
+	// Domain attribute of the session cookies, unset means the exact host only (COOKIE_DOMAIN)
+	CookieDomain string
+	// End sessions that have not been used for this long, zero never does (SESSION_IDLE_TIMEOUT)
+	SessionIdleTimeout time.Duration
+	// End sessions this long after they started however active they are, zero never does (SESSION_MAX_LIFETIME)
+	SessionMaxLifetime time.Duration
+	// How often sessions that have run out, and tokens that have expired, are deleted (SESSION_REAP_INTERVAL)
+	SessionReapInterval time.Duration
+	// How many first-party sessions a user may have at once, zero for no limit (MAX_SESSIONS_PER_USER).
+	// Users with max_sessions set use their own limit instead.
+	MaxSessionsPerUser int
+	// Whether a login past the limit evicts the least recently used session or is rejected (SESSION_LIMIT_POLICY)
+	SessionLimitPolicy SessionLimitPolicy
+	// How often the HMAC signing keys are reloaded from the database (JWT_KEY_RELOAD_INTERVAL)
+	KeyReloadInterval time.Duration
+	// Issuer identifier of the OpenID Connect provider, the public URL of this server (OIDC_ISSUER, defaults to BACKEND_URL)
+	Issuer string
+	// Audience named in the aud claim of every access token and required of the tokens we accept (TOKEN_AUDIENCE, defaults to the issuer)
+	TokenAudience string
+	// Optional claims added to the access tokens of users, a comma-separated list of username and role (TOKEN_CLAIMS)
+	TokenClaims []string
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		AccessTokenTTL:       15 * time.Minute,
+		RefreshTokenTTL:      30 * 24 * time.Hour,
+		VerificationTokenTTL: 24 * time.Hour,
+		SessionReapInterval:  10 * time.Minute,
+		SessionLimitPolicy:   SessionLimitEvict,
+		KeyReloadInterval:    time.Minute,
+		CookieSecure:         true,
+		CookieSameSite:       http.SameSiteLaxMode,
+	}
+}
+
+func ReadSettings() (settings Settings, err error) {
+	settings = DefaultSettings()
+
+	values, err := readEnvValues(
+		"EMAIL_LOWERCASE_LOCAL_PART",
+		"ACCESS_TOKEN_TTL", "REFRESH_TOKEN_TTL", "VERIFICATION_TOKEN_TTL",
+		"TRUST_PROXY_HEADERS",
+		"COOKIE_SESSIONS", "COOKIE_SECURE", "COOKIE_SAMESITE", "COOKIE_DOMAIN",
+		"SESSION_IDLE_TIMEOUT", "SESSION_MAX_LIFETIME", "SESSION_REAP_INTERVAL",
+		"MAX_SESSIONS_PER_USER", "SESSION_LIMIT_POLICY",
+		"JWT_KEY_RELOAD_INTERVAL",
+		"OIDC_ISSUER", "BACKEND_URL",
+		"TOKEN_AUDIENCE", "TOKEN_CLAIMS",
+	)
+	if err != nil {
+		return settings, err
+	}
+
+	settings.LowercaseEmailLocalPart, err = parseEnvBool(values, "EMAIL_LOWERCASE_LOCAL_PART", settings.LowercaseEmailLocalPart)
+	if err != nil {
+		return settings, err
+	}
+
+	settings.AccessTokenTTL, err = parseEnvDuration(values, "ACCESS_TOKEN_TTL", settings.AccessTokenTTL)
+	if err != nil {
+		return settings, err
+	}
+
+	settings.RefreshTokenTTL, err = parseEnvDuration(values, "REFRESH_TOKEN_TTL", settings.RefreshTokenTTL)
+	if err != nil {
+		return settings, err
+	}
+
+	settings.VerificationTokenTTL, err = parseEnvDuration(values, "VERIFICATION_TOKEN_TTL", settings.VerificationTokenTTL)
+	if err != nil {
+		return settings, err
+	}
+
+	settings.TrustProxyHeaders, err = parseEnvBool(values, "TRUST_PROXY_HEADERS", settings.TrustProxyHeaders)
+	if err != nil {
+		return settings, err
+	}
+
+	settings.CookieSessions, err = parseEnvBool(values, "COOKIE_SESSIONS", settings.CookieSessions)
+	if err != nil {
+		return settings, err
+	}
+
+	settings.CookieSecure, err = parseEnvBool(values, "COOKIE_SECURE", settings.CookieSecure)
+	if err != nil {
+		return settings, err
+	}
+
+	if sameSite, ok := values["COOKIE_SAMESITE"]; ok {
+		switch strings.ToLower(sameSite) {
+		case "lax":
+			settings.CookieSameSite = http.SameSiteLaxMode
+		case "strict":
+			settings.CookieSameSite = http.SameSiteStrictMode
+		case "none":
+			settings.CookieSameSite = http.SameSiteNoneMode
+		default:
+			return settings, fmt.Errorf("invalid COOKIE_SAMESITE value %q, expected lax, strict or none", sameSite)
+		}
+	}
+
+	if settings.CookieSameSite == http.SameSiteNoneMode && !settings.CookieSecure {
+		return settings, errors.New("COOKIE_SAMESITE=none requires COOKIE_SECURE")
+	}
+
+	settings.CookieDomain = values["COOKIE_DOMAIN"]
+
+	settings.SessionIdleTimeout, err = parseEnvDuration(values, "SESSION_IDLE_TIMEOUT", settings.SessionIdleTimeout)
+	if err != nil {
+		return settings, err
+	}
+
+	settings.SessionMaxLifetime, err = parseEnvDuration(values, "SESSION_MAX_LIFETIME", settings.SessionMaxLifetime)
+	if err != nil {
+		return settings, err
+	}
+
+	settings.SessionReapInterval, err = parseEnvDuration(values, "SESSION_REAP_INTERVAL", settings.SessionReapInterval)
+	if err != nil {
+		return settings, err
+	}
+
+	settings.MaxSessionsPerUser, err = parseEnvInt(values, "MAX_SESSIONS_PER_USER", settings.MaxSessionsPerUser)
+	if err != nil {
+		return settings, err
+	}
+
+	if policy, ok := values["SESSION_LIMIT_POLICY"]; ok {
+		switch SessionLimitPolicy(strings.ToLower(policy)) {
+		case SessionLimitEvict:
+			settings.SessionLimitPolicy = SessionLimitEvict
+		case SessionLimitReject:
+			settings.SessionLimitPolicy = SessionLimitReject
+		default:
+			return settings, fmt.Errorf("invalid SESSION_LIMIT_POLICY value %q, expected evict or reject", policy)
+		}
+	}
+
+	settings.KeyReloadInterval, err = parseEnvDuration(values, "JWT_KEY_RELOAD_INTERVAL", settings.KeyReloadInterval)
+	if err != nil {
+		return settings, err
+	}
+
+	settings.Issuer = values["OIDC_ISSUER"]
+	if settings.Issuer == "" {
+		settings.Issuer = values["BACKEND_URL"]
+	}
+	// Clients compare the issuer as a string, so it is kept without a trailing slash
+	settings.Issuer = strings.TrimSuffix(settings.Issuer, "/")
+
+	settings.TokenAudience = values["TOKEN_AUDIENCE"]
+	if settings.TokenAudience == "" {
+		settings.TokenAudience = settings.Issuer
+	}
+
+	for _, claim := range strings.Split(values["TOKEN_CLAIMS"], ",") {
+		claim = strings.ToLower(strings.TrimSpace(claim))
+		switch claim {
+		case "":
+		case ClaimUsername, ClaimRole:
+			settings.TokenClaims = append(settings.TokenClaims, claim)
+		default:
+			return settings, fmt.Errorf("invalid TOKEN_CLAIMS entry %q, expected username or role", claim)
+		}
+	}
+
+	if settings.AccessTokenTTL == 0 || settings.RefreshTokenTTL == 0 || settings.VerificationTokenTTL == 0 {
+		return settings, errors.New("ACCESS_TOKEN_TTL, REFRESH_TOKEN_TTL and VERIFICATION_TOKEN_TTL must be greater than zero")
+	}
+
+	if settings.SessionReapInterval == 0 {
+		return settings, errors.New("SESSION_REAP_INTERVAL must be greater than zero")
+	}
+
+	if settings.KeyReloadInterval == 0 {
+		return settings, errors.New("JWT_KEY_RELOAD_INTERVAL must be greater than zero")
+	}
+
+	return settings, nil
+}
+
+// What access tokens are issued and accepted with
+func (s Settings) TokenPolicy() TokenPolicy {
+	policy := TokenPolicy{
+		Issuer:   s.Issuer,
+		Audience: s.TokenAudience,
+	}
+	for _, claim := range s.TokenClaims {
+		switch claim {
+		case ClaimUsername:
+			policy.IncludeUsername = true
+		case ClaimRole:
+			policy.IncludeRole = true
+		}
+	}
+	return policy
+}
+
+// The limits sessions are held to
+func (s Settings) SessionPolicy() SessionPolicy {
+	return SessionPolicy{
+		IdleTimeout: s.SessionIdleTimeout,
+		MaxLifetime: s.SessionMaxLifetime,
+	}
+}
@@ -3,61 +3,227 @@ package utils
 import (
 	"context"
 	"database/sql"
-	"fmt"
+	"log"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/yuanzix/userAuth/internal/database"
 	"github.com/yuanzix/userAuth/models"
+	"github.com/yuanzix/userAuth/sql/migrations"
 )
 
 type Storage interface {
-	CreateUser(*models.User) (*database.User, error)
-	VerifyUser(string) error
-	IsUserVerified(string) (bool, error)
-	DeleteUser(string) error
-	UpdateUser(*models.User) (*database.User, error)
-	GetUserByEmail(string) (*database.User, error)
-	GetAllUsers() (*[]database.User, error)
-	GetHashedPassword(string) (hashedPassword string, err error)
-	GetAuth(string) (*database.Auth, error)
-	CreateAuth(string) (*database.Auth, error)
-	DeleteAuth(models.AuthDetails) error
-	DeleteAllAuth(string) error
-	CheckAuthExists(models.AuthDetails) (bool, error)
+	CreateUser(context.Context, *models.User) (*database.User, error)
+	VerifyUser(context.Context, int32) error
+	IsUserVerified(context.Context, string) (bool, error)
+	DeleteUser(context.Context, int32) error
+	UpdateUser(context.Context, int32, *models.User) (*database.User, error)
+	SetUserMaxSessions(ctx context.Context, userID int32, maxSessions sql.NullInt32) error
+	SetUserRole(ctx context.Context, userID int32, role sql.NullString) error
+	GetUserByEmail(context.Context, string) (*database.User, error)
+	GetUserByID(context.Context, int32) (*database.User, error)
+	ListUsers(context.Context, models.UserListParams) (*[]database.User, error)
+	GetHashedPassword(context.Context, string) (hashedPassword string, err error)
+	GetAuth(context.Context, int32) (*database.Auth, error)
+	GetAuthByID(context.Context, int32) (*database.Auth, error)
+	GetAuthByUUID(context.Context, models.AuthDetails) (*database.Auth, error)
+	ListAuth(context.Context, int32) (*[]database.Auth, error)
+	CreateAuth(context.Context, int32, models.SessionMetadata) (*database.Auth, error)
+	DeleteAuth(context.Context, models.AuthDetails) error
+	DeleteAuthByID(context.Context, int32) error
+	DeleteUserAuth(ctx context.Context, userID int32, authID int32) error
+	DeleteOtherAuth(context.Context, models.AuthDetails) (deleted int64, err error)
+	DeleteAllAuth(context.Context, int32) error
+	CheckAuthExists(context.Context, models.AuthDetails) (bool, error)
+	TouchAuth(context.Context, models.AuthDetails, SessionPolicy) (bool, error)
+	DeleteExpiredAuth(ctx context.Context, policy SessionPolicy, limit int32) (deleted int64, err error)
+	CountLiveAuth(ctx context.Context, userID int32, policy SessionPolicy) (int64, error)
+	DeleteLeastRecentlyUsedAuth(ctx context.Context, userID int32, policy SessionPolicy, limit int32) (deleted int64, err error)
+	CreateRefreshToken(ctx context.Context, authID int32, tokenHash string, expiresAt time.Time) (*database.RefreshToken, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (*database.RefreshToken, error)
+	UseRefreshToken(context.Context, int32) error
+	DeleteExpiredRefreshTokens(ctx context.Context, limit int32) (deleted int64, err error)
+	CreateVerificationToken(ctx context.Context, userID int32, purpose string, tokenHash string, expiresAt time.Time) (*database.VerificationToken, error)
+	ConsumeVerificationToken(ctx context.Context, purpose string, tokenHash string) (*database.VerificationToken, error)
+	DeleteStaleVerificationTokens(ctx context.Context, limit int32) (deleted int64, err error)
+	CreateOAuthClient(context.Context, *models.OAuthClient) (*database.OauthClient, error)
+	GetOAuthClient(context.Context, string) (*database.OauthClient, error)
+	ListOAuthClients(context.Context) (*[]database.OauthClient, error)
+	DeleteOAuthClient(context.Context, string) error
+	CreateAuthorizationCode(context.Context, *models.AuthorizationCode) error
+	ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*database.OauthAuthorizationCode, error)
+	DeleteExpiredAuthorizationCodes(ctx context.Context, limit int32) (deleted int64, err error)
+	CreatePersonalAccessToken(context.Context, *models.PersonalAccessToken) (*database.PersonalAccessToken, error)
+	ListPersonalAccessTokens(ctx context.Context, userID int32) (*[]database.PersonalAccessToken, error)
+	DeletePersonalAccessToken(ctx context.Context, userID int32, tokenID int32) error
+	UsePersonalAccessToken(ctx context.Context, tokenHash string) (*database.PersonalAccessToken, error)
+	CreateServiceClient(context.Context, *models.ServiceClient) (*database.ServiceClient, error)
+	GetServiceClient(context.Context, string) (*database.ServiceClient, error)
+	ListServiceClients(context.Context) (*[]database.ServiceClient, error)
+	DeleteServiceClient(context.Context, string) error
+	CreateDeviceCode(context.Context, *models.DeviceCode) error
+	GetDeviceCode(context.Context, string) (*database.DeviceCode, error)
+	GetPendingDeviceCode(context.Context, string) (*database.DeviceCode, error)
+	DecideDeviceCode(ctx context.Context, userCode string, userID int32, approved bool) error
+	MarkDeviceCodePolled(context.Context, string) error
+	ConsumeDeviceCode(context.Context, string) (*database.DeviceCode, error)
+	DeleteExpiredDeviceCodes(ctx context.Context, limit int32) (deleted int64, err error)
+	CreateHMACKey(ctx context.Context, kid string, secret []byte) (*database.JwtHmacKey, error)
+	ListHMACKeys(context.Context) (*[]database.JwtHmacKey, error)
+	PromoteHMACKey(context.Context, string) error
+	RetireHMACKey(context.Context, string) error
+	InTx(context.Context, func(Storage) error) error
 }
 
+// Upper bound for a single query unless POSTGRES_QUERY_TIMEOUT says otherwise,
+// applied on top of whatever deadline the caller's context carries.
+const defaultQueryTimeout = 5 * time.Second
+
 type PostgresStore struct {
-	queries *database.Queries
+	db           *sql.DB
+	tx           *sql.Tx
+	queries      *database.Queries
+	queryTimeout time.Duration
 }
 
-func NewPostgresStore() (*PostgresStore, error) {
-	host, port, username, dbName, password, err := ReadPostgresDetails()
+// Opens a connection pool configured by config and waits until the database is reachable
+func OpenPostgres(config PostgresConfig) (*sql.DB, error) {
+	connStr, err := config.ConnString()
+	if err != nil {
+		return nil, err
+	}
 
+	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return nil, err
 	}
 
-	connStr := fmt.Sprintf("host=%v port=%v user=%v dbname=%v password=%v sslmode=require", host, port, username, dbName, password)
+	if config.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(config.MaxOpenConns)
+	}
+	if config.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(config.MaxIdleConns)
+	}
+	if config.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(config.ConnMaxLifetime)
+	}
+	if config.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+	}
 
-	db, err := sql.Open("postgres", connStr)
+	backoff := config.ConnectBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), config.QueryTimeout)
+		err = db.PingContext(ctx)
+		cancel()
+
+		if err == nil {
+			return db, nil
+		}
+
+		if attempt >= config.ConnectRetries {
+			db.Close()
+			return nil, err
+		}
+
+		log.Printf("could not reach postgres, retrying in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func NewPostgresStore() (*PostgresStore, error) {
+	config, err := ReadPostgresConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := OpenPostgres(config)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := db.Ping(); err != nil {
+	autoMigrate, err := ReadAutoMigrate()
+	if err != nil {
+		db.Close()
 		return nil, err
 	}
 
+	if autoMigrate {
+		if err := migrateUp(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
 	queries := database.New(db)
 
 	return &PostgresStore{
-		queries: queries,
+		db:           db,
+		queries:      queries,
+		queryTimeout: config.QueryTimeout,
 	}, nil
 }
 
-func (s *PostgresStore) CreateUser(u *models.User) (*database.User, error) {
+func migrateUp(db *sql.DB) error {
+	migrator, err := NewMigrator(db, migrations.FS)
+	if err != nil {
+		return err
+	}
+
+	applied, err := migrator.Up(context.Background())
+	for _, migration := range applied {
+		log.Printf("applied migration %v", migration.Name)
+	}
+	return err
+}
+
+// InTx runs f with a store whose queries all belong to one transaction, which is
+// committed if f returns nil and rolled back otherwise. Calling InTx on the store
+// passed to f joins the existing transaction.
+func (s *PostgresStore) InTx(ctx context.Context, f func(Storage) error) error {
+	if s.tx != nil {
+		return f(s)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	txStore := &PostgresStore{
+		db:           s.db,
+		tx:           tx,
+		queries:      s.queries.WithTx(tx),
+		queryTimeout: s.queryTimeout,
+	}
 
-	user, err := s.queries.CreateUser(context.Background(), database.CreateUserParams{
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := f(txStore); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			log.Printf("could not roll back transaction: %v", rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresStore) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, s.queryTimeout)
+}
+
+func (s *PostgresStore) CreateUser(ctx context.Context, u *models.User) (*database.User, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	user, err := s.queries.CreateUser(ctx, database.CreateUserParams{
 		Email:          u.Email,
 		Username:       u.Username,
 		HashedPassword: u.HashedPassword,
@@ -65,89 +231,787 @@ func (s *PostgresStore) CreateUser(u *models.User) (*database.User, error) {
 		LastName:       u.LastName,
 		DateOfBirth:    u.DateOfBirth,
 	})
-	return &user, err
+	return &user, translateError(err, ErrUserNotFound)
 }
 
-func (s *PostgresStore) IsUserVerified(email string) (bool, error) {
-	verified, err := s.queries.IsUserVerified(context.Background(), email)
-	return verified, err
+func (s *PostgresStore) IsUserVerified(ctx context.Context, email string) (bool, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	verified, err := s.queries.IsUserVerified(ctx, email)
+	return verified, translateError(err, ErrUserNotFound)
 }
 
-func (s *PostgresStore) VerifyUser(email string) error {
-	err := s.queries.VerifyUser(context.Background(), email)
-	return err
+func (s *PostgresStore) VerifyUser(ctx context.Context, userID int32) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.VerifyUser(ctx, userID)
+	return rowsAffectedError(rows, err, ErrUserNotFound)
 }
 
-func (s *PostgresStore) DeleteUser(email string) error {
-	err := s.queries.DeleteUser(context.Background(), email)
-	return err
+// DeleteUser deletes the user along with all of their sessions
+func (s *PostgresStore) DeleteUser(ctx context.Context, userID int32) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.DeleteUser(ctx, userID)
+	return rowsAffectedError(rows, err, ErrUserNotFound)
 }
 
-func (s *PostgresStore) UpdateUser(u *models.User) (*database.User, error) {
-	return &database.User{}, nil
+// SetUserMaxSessions overrides how many sessions the user may have at once. NULL falls back
+// to the server-wide limit and 0 lifts the limit.
+func (s *PostgresStore) SetUserMaxSessions(ctx context.Context, userID int32, maxSessions sql.NullInt32) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.SetUserMaxSessions(ctx, database.SetUserMaxSessionsParams{
+		MaxSessions: maxSessions,
+		UserID:      userID,
+	})
+	return rowsAffectedError(rows, err, ErrUserNotFound)
+}
+
+// SetUserRole sets the role named in the user's tokens, NULL leaves it out
+func (s *PostgresStore) SetUserRole(ctx context.Context, userID int32, role sql.NullString) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.SetUserRole(ctx, database.SetUserRoleParams{
+		Role:   role,
+		UserID: userID,
+	})
+	return rowsAffectedError(rows, err, ErrUserNotFound)
 }
 
-func (s *PostgresStore) GetUserByEmail(email string) (*database.User, error) {
-	user, err := s.queries.GetUserByEmail(context.Background(), email)
+// UpdateUser updates the given fields of the user. Zero-valued fields, and the email, are left unchanged.
+func (s *PostgresStore) UpdateUser(ctx context.Context, userID int32, u *models.User) (*database.User, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	user, err := s.queries.UpdateUser(ctx, database.UpdateUserParams{
+		Username:    sql.NullString{String: u.Username, Valid: u.Username != ""},
+		FirstName:   sql.NullString{String: u.FirstName, Valid: u.FirstName != ""},
+		LastName:    sql.NullString{String: u.LastName, Valid: u.LastName != ""},
+		DateOfBirth: sql.NullTime{Time: u.DateOfBirth, Valid: !u.DateOfBirth.IsZero()},
+		UserID:      userID,
+	})
 	if err != nil {
-		return &database.User{}, err
+		return &database.User{}, translateError(err, ErrUserNotFound)
 	}
 	return &user, nil
 }
 
-func (s *PostgresStore) GetAllUsers() (*[]database.User, error) {
-	users, err := s.queries.GetAllUsers(context.Background())
+func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*database.User, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	user, err := s.queries.GetUserByEmail(ctx, email)
 	if err != nil {
-		return nil, err
+		return &database.User{}, translateError(err, ErrUserNotFound)
+	}
+	return &user, nil
+}
+
+func (s *PostgresStore) GetUserByID(ctx context.Context, userID int32) (*database.User, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	user, err := s.queries.GetUserByID(ctx, userID)
+	if err != nil {
+		return &database.User{}, translateError(err, ErrUserNotFound)
+	}
+	return &user, nil
+}
+
+func (s *PostgresStore) ListUsers(ctx context.Context, params models.UserListParams) (*[]database.User, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	createdAtParams := database.ListUsersByCreatedAtParams{RowLimit: params.Limit}
+	usernameParams := database.ListUsersByUsernameParams{RowLimit: params.Limit}
+
+	if params.Verified != nil {
+		createdAtParams.Verified = sql.NullBool{Bool: *params.Verified, Valid: true}
+		usernameParams.Verified = createdAtParams.Verified
+	}
+	if params.CreatedAfter != nil {
+		createdAtParams.CreatedAfter = sql.NullTime{Time: *params.CreatedAfter, Valid: true}
+		usernameParams.CreatedAfter = createdAtParams.CreatedAfter
+	}
+	if params.CreatedBefore != nil {
+		createdAtParams.CreatedBefore = sql.NullTime{Time: *params.CreatedBefore, Valid: true}
+		usernameParams.CreatedBefore = createdAtParams.CreatedBefore
+	}
+	if params.After != nil {
+		createdAtParams.AfterUserID = sql.NullInt32{Int32: params.After.UserID, Valid: true}
+		createdAtParams.AfterCreatedAt = sql.NullTime{Time: params.After.CreatedAt, Valid: true}
+		usernameParams.AfterUserID = createdAtParams.AfterUserID
+		usernameParams.AfterUsername = sql.NullString{String: params.After.Username, Valid: true}
+	}
+
+	var users []database.User
+	var err error
+
+	switch {
+	case params.SortBy == models.UserSortUsername && params.Descending:
+		users, err = s.queries.ListUsersByUsernameDesc(ctx, database.ListUsersByUsernameDescParams(usernameParams))
+	case params.SortBy == models.UserSortUsername:
+		users, err = s.queries.ListUsersByUsername(ctx, usernameParams)
+	case params.Descending:
+		users, err = s.queries.ListUsersByCreatedAtDesc(ctx, database.ListUsersByCreatedAtDescParams(createdAtParams))
+	default:
+		users, err = s.queries.ListUsersByCreatedAt(ctx, createdAtParams)
+	}
+
+	if err != nil {
+		return nil, translateError(err, ErrUserNotFound)
 	}
 	return &users, nil
 }
 
-func (s *PostgresStore) GetHashedPassword(email string) (hashedPassword string, err error) {
-	hashedPassword, err = s.queries.GetHashedPassword(context.Background(), email)
+func (s *PostgresStore) GetHashedPassword(ctx context.Context, email string) (hashedPassword string, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	hashedPassword, err = s.queries.GetHashedPassword(ctx, email)
 
 	if err != nil {
-		return "", err
+		return "", translateError(err, ErrUserNotFound)
 	}
 
 	return hashedPassword, nil
 }
 
-func (s *PostgresStore) CreateAuth(email string) (*database.Auth, error) {
-	auth, err := s.queries.CreateAuth(context.Background(), email)
+func (s *PostgresStore) CreateAuth(ctx context.Context, userID int32, meta models.SessionMetadata) (*database.Auth, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	auth, err := s.queries.CreateAuth(ctx, database.CreateAuthParams{
+		UserID:     userID,
+		IpAddress:  meta.IPAddress,
+		UserAgent:  meta.UserAgent,
+		DeviceName: meta.DeviceName,
+		ClientID:   sql.NullString{String: meta.ClientID, Valid: meta.ClientID != ""},
+		Scope:      meta.Scope,
+		// Written from here in UTC like the cutoffs they are compared with, whatever
+		// time zone the database is in
+		CreatedAt: time.Now().UTC(),
+	})
 
 	if err != nil {
-		return &database.Auth{}, err
+		return &database.Auth{}, translateError(err, ErrSessionNotFound)
 	}
 	return &auth, nil
 }
 
-func (s *PostgresStore) GetAuth(email string) (*database.Auth, error) {
-	auth, err := s.queries.GetAuth(context.Background(), email)
+func (s *PostgresStore) GetAuth(ctx context.Context, userID int32) (*database.Auth, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	auth, err := s.queries.GetAuth(ctx, userID)
 	if err != nil {
-		return &database.Auth{}, err
+		return &database.Auth{}, translateError(err, ErrSessionNotFound)
 	}
 	return &auth, nil
 }
 
-func (s *PostgresStore) DeleteAuth(auth models.AuthDetails) error {
-	err := s.queries.DeleteAuth(context.Background(), database.DeleteAuthParams{
-		UserEmail: auth.UserEmail,
-		AuthUuid:  auth.AuthUUID,
+func (s *PostgresStore) GetAuthByID(ctx context.Context, authID int32) (*database.Auth, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	auth, err := s.queries.GetAuthByID(ctx, authID)
+	if err != nil {
+		return &database.Auth{}, translateError(err, ErrSessionNotFound)
+	}
+	return &auth, nil
+}
+
+// GetAuthByUUID returns the session an access token belongs to
+func (s *PostgresStore) GetAuthByUUID(ctx context.Context, details models.AuthDetails) (*database.Auth, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	auth, err := s.queries.GetAuthByUUID(ctx, database.GetAuthByUUIDParams{
+		UserID:   details.UserID,
+		AuthUuid: details.AuthUUID,
 	})
+	if err != nil {
+		return &database.Auth{}, translateError(err, ErrSessionNotFound)
+	}
+	return &auth, nil
+}
 
-	return err
+// ListAuth returns the user's sessions, most recently used first
+func (s *PostgresStore) ListAuth(ctx context.Context, userID int32) (*[]database.Auth, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	auths, err := s.queries.ListAuthByUser(ctx, userID)
+	if err != nil {
+		return nil, translateError(err, ErrSessionNotFound)
+	}
+	return &auths, nil
 }
 
-func (s *PostgresStore) DeleteAllAuth(email string) error {
-	err := s.queries.DeleteAllAuth(context.Background(), email)
-	return err
+func (s *PostgresStore) DeleteAuth(ctx context.Context, auth models.AuthDetails) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.DeleteAuth(ctx, database.DeleteAuthParams{
+		UserID:   auth.UserID,
+		AuthUuid: auth.AuthUUID,
+	})
+
+	return rowsAffectedError(rows, err, ErrSessionNotFound)
+}
+
+// DeleteAuthByID deletes a session along with its refresh tokens
+func (s *PostgresStore) DeleteAuthByID(ctx context.Context, authID int32) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.DeleteAuthByID(ctx, authID)
+	return rowsAffectedError(rows, err, ErrSessionNotFound)
+}
+
+// DeleteUserAuth deletes one of the user's sessions, failing with ErrSessionNotFound if it belongs to someone else
+func (s *PostgresStore) DeleteUserAuth(ctx context.Context, userID int32, authID int32) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.DeleteUserAuthByID(ctx, database.DeleteUserAuthByIDParams{
+		AuthID: authID,
+		UserID: userID,
+	})
+	return rowsAffectedError(rows, err, ErrSessionNotFound)
 }
 
-func (s *PostgresStore) CheckAuthExists(auth models.AuthDetails) (exists bool, err error) {
-	exists, err = s.queries.CheckAuthExists(context.Background(), database.CheckAuthExistsParams{
-		UserEmail: auth.UserEmail,
-		AuthUuid:  auth.AuthUUID,
+// DeleteOtherAuth deletes every session of the user except the given one
+func (s *PostgresStore) DeleteOtherAuth(ctx context.Context, auth models.AuthDetails) (deleted int64, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	deleted, err = s.queries.DeleteOtherAuth(ctx, database.DeleteOtherAuthParams{
+		UserID:   auth.UserID,
+		AuthUuid: auth.AuthUUID,
+	})
+	return deleted, translateError(err, ErrSessionNotFound)
+}
+
+func (s *PostgresStore) DeleteAllAuth(ctx context.Context, userID int32) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err := s.queries.DeleteAllAuth(ctx, userID)
+	return translateError(err, ErrSessionNotFound)
+}
+
+func (s *PostgresStore) CheckAuthExists(ctx context.Context, auth models.AuthDetails) (exists bool, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	exists, err = s.queries.CheckAuthExists(ctx, database.CheckAuthExistsParams{
+		UserID:   auth.UserID,
+		AuthUuid: auth.AuthUUID,
 	})
-	return
+	return exists, translateError(err, ErrSessionNotFound)
+}
+
+// TouchAuth records that the session was just used and reports whether it exists and
+// has not run out under the policy. Sessions that have run out are left untouched.
+func (s *PostgresStore) TouchAuth(ctx context.Context, auth models.AuthDetails, policy SessionPolicy) (exists bool, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	idleCutoff, lifetimeCutoff := policy.Cutoffs(now)
+	rows, err := s.queries.TouchAuth(ctx, database.TouchAuthParams{
+		LastUsedAt:     now.UTC(),
+		UserID:         auth.UserID,
+		AuthUuid:       auth.AuthUUID,
+		IdleCutoff:     idleCutoff,
+		LifetimeCutoff: lifetimeCutoff,
+	})
+	if err != nil {
+		return false, translateError(err, ErrSessionNotFound)
+	}
+	return rows > 0, nil
+}
+
+// CountLiveAuth counts the user's first-party sessions that have not run out under the
+// policy. Sessions granted to OAuth clients are not counted.
+func (s *PostgresStore) CountLiveAuth(ctx context.Context, userID int32, policy SessionPolicy) (int64, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	idleCutoff, lifetimeCutoff := policy.Cutoffs(time.Now())
+	count, err := s.queries.CountLiveAuth(ctx, database.CountLiveAuthParams{
+		UserID:         userID,
+		IdleCutoff:     idleCutoff,
+		LifetimeCutoff: lifetimeCutoff,
+	})
+	return count, translateError(err, ErrSessionNotFound)
+}
+
+// DeleteLeastRecentlyUsedAuth deletes up to limit of the user's live first-party sessions,
+// those used longest ago first
+func (s *PostgresStore) DeleteLeastRecentlyUsedAuth(ctx context.Context, userID int32, policy SessionPolicy, limit int32) (deleted int64, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	idleCutoff, lifetimeCutoff := policy.Cutoffs(time.Now())
+	deleted, err = s.queries.DeleteLeastRecentlyUsedAuth(ctx, database.DeleteLeastRecentlyUsedAuthParams{
+		UserID:         userID,
+		IdleCutoff:     idleCutoff,
+		LifetimeCutoff: lifetimeCutoff,
+		RowLimit:       limit,
+	})
+	return deleted, translateError(err, ErrSessionNotFound)
+}
+
+// DeleteExpiredAuth deletes up to limit sessions that have run out under the policy
+func (s *PostgresStore) DeleteExpiredAuth(ctx context.Context, policy SessionPolicy, limit int32) (deleted int64, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	idleCutoff, lifetimeCutoff := policy.Cutoffs(time.Now())
+	deleted, err = s.queries.DeleteExpiredAuth(ctx, database.DeleteExpiredAuthParams{
+		IdleCutoff:     idleCutoff,
+		LifetimeCutoff: lifetimeCutoff,
+		RowLimit:       limit,
+	})
+	return deleted, translateError(err, ErrSessionNotFound)
+}
+
+func (s *PostgresStore) CreateRefreshToken(ctx context.Context, authID int32, tokenHash string, expiresAt time.Time) (*database.RefreshToken, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	refreshToken, err := s.queries.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		AuthID:    authID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt.UTC(),
+	})
+	if err != nil {
+		return &database.RefreshToken{}, translateError(err, ErrRefreshTokenNotFound)
+	}
+	return &refreshToken, nil
+}
+
+func (s *PostgresStore) GetRefreshToken(ctx context.Context, tokenHash string) (*database.RefreshToken, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	refreshToken, err := s.queries.GetRefreshTokenByHash(ctx, tokenHash)
+	if err != nil {
+		return &database.RefreshToken{}, translateError(err, ErrRefreshTokenNotFound)
+	}
+	return &refreshToken, nil
+}
+
+// UseRefreshToken marks the token as exchanged. It fails with ErrRefreshTokenReused
+// if it already was, including by a concurrent request that got there first.
+func (s *PostgresStore) UseRefreshToken(ctx context.Context, refreshTokenID int32) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.UseRefreshToken(ctx, refreshTokenID)
+	return rowsAffectedError(rows, err, ErrRefreshTokenReused)
+}
+
+// DeleteExpiredRefreshTokens deletes up to limit refresh tokens that have expired. Used
+// ones are kept until then, so that replaying one is still caught and ends the session.
+func (s *PostgresStore) DeleteExpiredRefreshTokens(ctx context.Context, limit int32) (deleted int64, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	deleted, err = s.queries.DeleteExpiredRefreshTokens(ctx, database.DeleteExpiredRefreshTokensParams{
+		Cutoff:   time.Now().UTC(),
+		RowLimit: limit,
+	})
+	return deleted, translateError(err, ErrRefreshTokenNotFound)
+}
+
+func (s *PostgresStore) CreateVerificationToken(ctx context.Context, userID int32, purpose string, tokenHash string, expiresAt time.Time) (*database.VerificationToken, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	verificationToken, err := s.queries.CreateVerificationToken(ctx, database.CreateVerificationTokenParams{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt.UTC(),
+	})
+	if err != nil {
+		return &database.VerificationToken{}, translateError(err, ErrVerificationTokenInvalid)
+	}
+	return &verificationToken, nil
+}
+
+// ConsumeVerificationToken marks an unexpired token issued for purpose as used, so it cannot be used again
+func (s *PostgresStore) ConsumeVerificationToken(ctx context.Context, purpose string, tokenHash string) (*database.VerificationToken, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	verificationToken, err := s.queries.ConsumeVerificationToken(ctx, database.ConsumeVerificationTokenParams{
+		TokenHash: tokenHash,
+		Purpose:   purpose,
+		ExpiresAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return &database.VerificationToken{}, translateError(err, ErrVerificationTokenInvalid)
+	}
+	return &verificationToken, nil
+}
+
+// DeleteStaleVerificationTokens deletes up to limit verification tokens that have been used or have expired
+func (s *PostgresStore) DeleteStaleVerificationTokens(ctx context.Context, limit int32) (deleted int64, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	deleted, err = s.queries.DeleteStaleVerificationTokens(ctx, database.DeleteStaleVerificationTokensParams{
+		Cutoff:   time.Now().UTC(),
+		RowLimit: limit,
+	})
+	return deleted, translateError(err, ErrVerificationTokenInvalid)
+}
+
+func (s *PostgresStore) CreateOAuthClient(ctx context.Context, c *models.OAuthClient) (*database.OauthClient, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	client, err := s.queries.CreateOAuthClient(ctx, database.CreateOAuthClientParams{
+		ClientID:         c.ClientID,
+		ClientName:       c.Name,
+		ClientSecretHash: sql.NullString{String: c.SecretHash, Valid: c.SecretHash != ""},
+		RedirectUris:     c.RedirectURIs,
+		// A nil slice would be sent as NULL rather than an empty array
+		Scopes:   append([]string{}, c.Scopes...),
+		Audience: append([]string{}, c.Audience...),
+	})
+	if err != nil {
+		return &database.OauthClient{}, translateError(err, ErrClientNotFound)
+	}
+	return &client, nil
+}
+
+func (s *PostgresStore) GetOAuthClient(ctx context.Context, clientID string) (*database.OauthClient, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	client, err := s.queries.GetOAuthClient(ctx, clientID)
+	if err != nil {
+		return &database.OauthClient{}, translateError(err, ErrClientNotFound)
+	}
+	return &client, nil
+}
+
+func (s *PostgresStore) ListOAuthClients(ctx context.Context) (*[]database.OauthClient, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	clients, err := s.queries.ListOAuthClients(ctx)
+	if err != nil {
+		return nil, translateError(err, ErrClientNotFound)
+	}
+	return &clients, nil
+}
+
+// DeleteOAuthClient deletes the client along with every session and code granted to it
+func (s *PostgresStore) DeleteOAuthClient(ctx context.Context, clientID string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.DeleteOAuthClient(ctx, clientID)
+	return rowsAffectedError(rows, err, ErrClientNotFound)
+}
+
+func (s *PostgresStore) CreateAuthorizationCode(ctx context.Context, code *models.AuthorizationCode) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err := s.queries.CreateAuthorizationCode(ctx, database.CreateAuthorizationCodeParams{
+		CodeHash:            code.CodeHash,
+		ClientID:            code.ClientID,
+		UserID:              code.UserID,
+		RedirectUri:         code.RedirectURI,
+		RedirectUriExplicit: code.RedirectURIExplicit,
+		Scope:               code.Scope,
+		CodeChallenge:       code.CodeChallenge,
+		ExpiresAt:           code.ExpiresAt.UTC(),
+		Nonce:               code.Nonce,
+	})
+	return translateError(err, ErrAuthCodeInvalid)
+}
+
+// ConsumeAuthorizationCode deletes an unexpired code and returns it, so each code can be redeemed once
+func (s *PostgresStore) ConsumeAuthorizationCode(ctx context.Context, codeHash string) (*database.OauthAuthorizationCode, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	code, err := s.queries.ConsumeAuthorizationCode(ctx, database.ConsumeAuthorizationCodeParams{
+		CodeHash:  codeHash,
+		ExpiresAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return &database.OauthAuthorizationCode{}, translateError(err, ErrAuthCodeInvalid)
+	}
+	return &code, nil
+}
+
+// DeleteExpiredAuthorizationCodes deletes up to limit codes that expired without being redeemed
+func (s *PostgresStore) DeleteExpiredAuthorizationCodes(ctx context.Context, limit int32) (deleted int64, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	deleted, err = s.queries.DeleteExpiredAuthorizationCodes(ctx, database.DeleteExpiredAuthorizationCodesParams{
+		Cutoff:   time.Now().UTC(),
+		RowLimit: limit,
+	})
+	return deleted, translateError(err, ErrAuthCodeInvalid)
+}
+
+func (s *PostgresStore) CreatePersonalAccessToken(ctx context.Context, t *models.PersonalAccessToken) (*database.PersonalAccessToken, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	token, err := s.queries.CreatePersonalAccessToken(ctx, database.CreatePersonalAccessTokenParams{
+		UserID:    t.UserID,
+		Name:      t.Name,
+		TokenHash: t.TokenHash,
+		Scopes:    t.Scopes,
+		ExpiresAt: sql.NullTime{Time: t.ExpiresAt.UTC(), Valid: !t.ExpiresAt.IsZero()},
+	})
+	if err != nil {
+		return &database.PersonalAccessToken{}, translateError(err, ErrPersonalAccessTokenNotFound)
+	}
+	return &token, nil
+}
+
+// ListPersonalAccessTokens returns the user's tokens, newest first, expired ones included
+func (s *PostgresStore) ListPersonalAccessTokens(ctx context.Context, userID int32) (*[]database.PersonalAccessToken, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	tokens, err := s.queries.ListPersonalAccessTokensByUser(ctx, userID)
+	if err != nil {
+		return nil, translateError(err, ErrPersonalAccessTokenNotFound)
+	}
+	return &tokens, nil
+}
+
+func (s *PostgresStore) DeletePersonalAccessToken(ctx context.Context, userID int32, tokenID int32) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.DeleteUserPersonalAccessToken(ctx, database.DeleteUserPersonalAccessTokenParams{
+		PersonalAccessTokenID: tokenID,
+		UserID:                userID,
+	})
+	return rowsAffectedError(rows, err, ErrPersonalAccessTokenNotFound)
+}
+
+// UsePersonalAccessToken looks up an unexpired token and records that it was just used
+func (s *PostgresStore) UsePersonalAccessToken(ctx context.Context, tokenHash string) (*database.PersonalAccessToken, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	token, err := s.queries.UsePersonalAccessToken(ctx, database.UsePersonalAccessTokenParams{
+		TokenHash: tokenHash,
+		Now:       sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	if err != nil {
+		return &database.PersonalAccessToken{}, translateError(err, ErrPersonalAccessTokenNotFound)
+	}
+	return &token, nil
+}
+
+func (s *PostgresStore) CreateServiceClient(ctx context.Context, c *models.ServiceClient) (*database.ServiceClient, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	client, err := s.queries.CreateServiceClient(ctx, database.CreateServiceClientParams{
+		ClientID:         c.ClientID,
+		ClientName:       c.Name,
+		ClientSecretHash: c.SecretHash,
+		Scopes:           append([]string{}, c.Scopes...),
+		Audience:         append([]string{}, c.Audience...),
+	})
+	if err != nil {
+		return &database.ServiceClient{}, translateError(err, ErrServiceClientNotFound)
+	}
+	return &client, nil
+}
+
+func (s *PostgresStore) GetServiceClient(ctx context.Context, clientID string) (*database.ServiceClient, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	client, err := s.queries.GetServiceClient(ctx, clientID)
+	if err != nil {
+		return &database.ServiceClient{}, translateError(err, ErrServiceClientNotFound)
+	}
+	return &client, nil
+}
+
+func (s *PostgresStore) ListServiceClients(ctx context.Context) (*[]database.ServiceClient, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	clients, err := s.queries.ListServiceClients(ctx)
+	if err != nil {
+		return nil, translateError(err, ErrServiceClientNotFound)
+	}
+	return &clients, nil
+}
+
+// DeleteServiceClient deletes the client, after which the tokens it was issued are refused
+func (s *PostgresStore) DeleteServiceClient(ctx context.Context, clientID string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.DeleteServiceClient(ctx, clientID)
+	return rowsAffectedError(rows, err, ErrServiceClientNotFound)
+}
+
+func (s *PostgresStore) CreateDeviceCode(ctx context.Context, code *models.DeviceCode) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err := s.queries.CreateDeviceCode(ctx, database.CreateDeviceCodeParams{
+		DeviceCodeHash: code.DeviceCodeHash,
+		UserCode:       code.UserCode,
+		DeviceName:     code.DeviceName,
+		ExpiresAt:      code.ExpiresAt.UTC(),
+	})
+	return translateError(err, ErrDeviceCodeNotFound)
+}
+
+func (s *PostgresStore) GetDeviceCode(ctx context.Context, deviceCodeHash string) (*database.DeviceCode, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	code, err := s.queries.GetDeviceCode(ctx, deviceCodeHash)
+	if err != nil {
+		return &database.DeviceCode{}, translateError(err, ErrDeviceCodeNotFound)
+	}
+	return &code, nil
+}
+
+// GetPendingDeviceCode finds the unexpired code the user has yet to approve or deny
+func (s *PostgresStore) GetPendingDeviceCode(ctx context.Context, userCode string) (*database.DeviceCode, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	code, err := s.queries.GetPendingDeviceCode(ctx, database.GetPendingDeviceCodeParams{
+		UserCode:  userCode,
+		ExpiresAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return &database.DeviceCode{}, translateError(err, ErrDeviceCodeNotFound)
+	}
+	return &code, nil
+}
+
+// DecideDeviceCode records the user's answer to a pending code. A code is decided once.
+func (s *PostgresStore) DecideDeviceCode(ctx context.Context, userCode string, userID int32, approved bool) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	status := models.DeviceCodeDenied
+	if approved {
+		status = models.DeviceCodeApproved
+	}
+
+	rows, err := s.queries.DecideDeviceCode(ctx, database.DecideDeviceCodeParams{
+		UserCode:  userCode,
+		Status:    status,
+		UserID:    sql.NullInt32{Int32: userID, Valid: true},
+		ExpiresAt: time.Now().UTC(),
+	})
+	return rowsAffectedError(rows, err, ErrDeviceCodeNotFound)
+}
+
+// MarkDeviceCodePolled records when the device last asked for its tokens
+func (s *PostgresStore) MarkDeviceCodePolled(ctx context.Context, deviceCodeHash string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	err := s.queries.MarkDeviceCodePolled(ctx, database.MarkDeviceCodePolledParams{
+		DeviceCodeHash: deviceCodeHash,
+		LastPolledAt:   sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	return translateError(err, ErrDeviceCodeNotFound)
+}
+
+// ConsumeDeviceCode deletes the code and returns it, so an approved code is redeemed once
+func (s *PostgresStore) ConsumeDeviceCode(ctx context.Context, deviceCodeHash string) (*database.DeviceCode, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	code, err := s.queries.ConsumeDeviceCode(ctx, deviceCodeHash)
+	if err != nil {
+		return &database.DeviceCode{}, translateError(err, ErrDeviceCodeNotFound)
+	}
+	return &code, nil
+}
+
+// DeleteExpiredDeviceCodes deletes up to limit device codes that expired before the device redeemed them
+func (s *PostgresStore) DeleteExpiredDeviceCodes(ctx context.Context, limit int32) (deleted int64, err error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	deleted, err = s.queries.DeleteExpiredDeviceCodes(ctx, database.DeleteExpiredDeviceCodesParams{
+		Cutoff:   time.Now().UTC(),
+		RowLimit: limit,
+	})
+	return deleted, translateError(err, ErrDeviceCodeNotFound)
+}
+
+func (s *PostgresStore) CreateHMACKey(ctx context.Context, kid string, secret []byte) (*database.JwtHmacKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	key, err := s.queries.CreateHMACKey(ctx, database.CreateHMACKeyParams{
+		Kid:    kid,
+		Secret: secret,
+	})
+	if err != nil {
+		return &database.JwtHmacKey{}, translateError(err, ErrHMACKeyNotFound)
+	}
+	return &key, nil
+}
+
+func (s *PostgresStore) ListHMACKeys(ctx context.Context) (*[]database.JwtHmacKey, error) {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	keys, err := s.queries.ListHMACKeys(ctx)
+	if err != nil {
+		return nil, translateError(err, ErrHMACKeyNotFound)
+	}
+	return &keys, nil
+}
+
+// PromoteHMACKey makes the key the one new tokens are signed with, the previous one is
+// then only used to verify tokens
+func (s *PostgresStore) PromoteHMACKey(ctx context.Context, kid string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.PromoteHMACKey(ctx, database.PromoteHMACKeyParams{
+		Kid:        kid,
+		PromotedAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+	})
+	return rowsAffectedError(rows, err, ErrHMACKeyNotFound)
+}
+
+// RetireHMACKey deletes the key, after which the tokens it signed are refused
+func (s *PostgresStore) RetireHMACKey(ctx context.Context, kid string) error {
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := s.queries.RetireHMACKey(ctx, kid)
+	return rowsAffectedError(rows, err, ErrHMACKeyNotFound)
 }
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// How far the clocks of the servers issuing and checking a token may drift apart
+const tokenLeeway = 30 * time.Second
+
+// The optional claims TOKEN_CLAIMS can add to the access tokens of users
+const (
+	ClaimUsername = "username"
+	ClaimRole     = "role"
+)
+
+// TokenPolicy decides what access tokens say about who issued them and who they are for,
+// and which optional claims they carry
+type TokenPolicy struct {
+	// Named in the iss claim, tokens naming another issuer are refused. Empty is not enforced.
+	Issuer string
+	// Named in the aud claim of every token, tokens not meant for it are refused. Empty is not enforced.
+	Audience string
+	// Add the username claim to the tokens of users
+	IncludeUsername bool
+	// Add the role claim to the tokens of users that have a role
+	IncludeRole bool
+}
+
+// The aud claim of a token, our own audience followed by those of the client it was issued to
+func (p TokenPolicy) audience(clientAudience []string) jwt.ClaimStrings {
+	audience := jwt.ClaimStrings{}
+	if p.Audience != "" {
+		audience = append(audience, p.Audience)
+	}
+	for _, aud := range clientAudience {
+		if aud != p.Audience {
+			audience = append(audience, aud)
+		}
+	}
+	return audience
+}
+
+// Options that hold the parsed token to the policy
+func (p TokenPolicy) parserOptions() []jwt.ParserOption {
+	options := []jwt.ParserOption{jwt.WithExpirationRequired(), jwt.WithIssuedAt(), jwt.WithLeeway(tokenLeeway)}
+	if p.Issuer != "" {
+		options = append(options, jwt.WithIssuer(p.Issuer))
+	}
+	if p.Audience != "" {
+		options = append(options, jwt.WithAudience(p.Audience))
+	}
+	return options
+}
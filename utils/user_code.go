@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+)
+
+// User codes are typed by hand, so they leave out vowels, which could spell words, and
+// digits, which are easily mistaken for letters (RFC 8628 section 6.1)
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+const userCodeLength = 8
+
+// Generates a code like WDJB-MJHT for the user to enter when approving a device
+func GenerateUserCode() (string, error) {
+	code := make([]byte, userCodeLength)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeAlphabet[n.Int64()]
+	}
+
+	return formatUserCode(string(code)), nil
+}
+
+// Brings a user code as typed, in any case and with or without the dash, into the form it is stored in
+func NormalizeUserCode(input string) string {
+	code := strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(input))
+
+	if len(code) != userCodeLength {
+		return code
+	}
+	return formatUserCode(code)
+}
+
+func formatUserCode(code string) string {
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}